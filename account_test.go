@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	m "final-project/model"
+)
+
+func TestDeleteAccount(t *testing.T) {
+	tests := []struct {
+		reviews     string
+		wantReviews int
+	}{
+		{reviews: "anonymize", wantReviews: 1},
+		{reviews: "delete", wantReviews: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.reviews, func(t *testing.T) {
+			s := newTestServer(t, map[string]string{"DELETED_USER_REVIEWS": tt.reviews})
+			ctx := context.Background()
+			game := m.Game{Title: "Test Game"}
+			if err := s.repos.Games.Create(ctx, &game); err != nil {
+				t.Fatal(err)
+			}
+			s.register("user@example.com")
+			userID := s.userID("user@example.com")
+			session := s.login("user@example.com", testPassword)
+			response := s.expect(http.StatusCreated, "POST", "/api-keys", bearer(session.access), m.APIKeyRequest{Name: "test", Scopes: []string{m.ScopeAccount}})
+			key := response["key"].(string)
+			s.expect(http.StatusOK, "POST", "/game/review", bearer(session.access), m.Review{GameID: game.ID, Rating: 8, Description: "Fun"})
+			s.expect(http.StatusOK, "POST", "/game-wish", bearer(session.access), m.Wishlist{GameID: game.ID})
+			s.expect(http.StatusOK, "GET", "/user/me/export", bearer(session.access), nil)
+
+			s.expect(http.StatusForbidden, "DELETE", "/user/me", bearer(session.access), m.DeleteAccountRequest{Password: otherPassword})
+			s.expect(http.StatusOK, "DELETE", "/user/me", bearer(session.access), m.DeleteAccountRequest{Password: testPassword})
+
+			s.expect(http.StatusUnauthorized, "GET", "/user", bearer(session.access), nil)
+			s.expect(http.StatusUnauthorized, "GET", "/user", apiKey(key), nil)
+			s.expect(http.StatusUnauthorized, "POST", "/user/token/refresh", nil, m.RefreshRequest{RefreshToken: session.refresh})
+			s.expect(http.StatusUnauthorized, "POST", "/user/login", nil, credentials("user@example.com", testPassword))
+
+			reviews, err := s.repos.Reviews.List(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(reviews) != tt.wantReviews {
+				t.Fatalf("%d reviews left, want %d", len(reviews), tt.wantReviews)
+			}
+			for _, review := range reviews {
+				if review.UserID == userID {
+					t.Errorf("review %d still belongs to the deleted user", review.ID)
+				}
+			}
+			wishlist, err := s.repos.Wishlists.ListByUser(ctx, userID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(wishlist) != 0 {
+				t.Errorf("%d wishlist items left, want 0", len(wishlist))
+			}
+		})
+	}
+}
+
+func TestLastUserManager(t *testing.T) {
+	s := newTestServer(t, nil)
+	admin := s.login(adminEmail, testPassword)
+	adminID := s.userID(adminEmail)
+	s.register("user@example.com")
+	userID := s.userID("user@example.com")
+
+	steps := []struct {
+		name   string
+		method string
+		path   string
+		body   interface{}
+		want   int
+	}{
+		{"cannot delete own account", "DELETE", "/user/me", m.DeleteAccountRequest{Password: testPassword}, http.StatusConflict},
+		{"cannot be deleted by id", "DELETE", fmt.Sprintf("/user/%d", adminID), nil, http.StatusConflict},
+		{"cannot give up the role", "PUT", fmt.Sprintf("/user/%d/role", adminID), m.UserRoleRequest{RoleID: m.RoleUser}, http.StatusConflict},
+		{"promotes another user", "PUT", fmt.Sprintf("/user/%d/role", userID), m.UserRoleRequest{RoleID: m.RoleAdmin}, http.StatusOK},
+		{"may give up the role once not last", "PUT", fmt.Sprintf("/user/%d/role", adminID), m.UserRoleRequest{RoleID: m.RoleUser}, http.StatusOK},
+	}
+	for _, step := range steps {
+		if w := s.do(step.method, step.path, bearer(admin.access), step.body); w.Code != step.want {
+			t.Fatalf("%s: %s %s = %d %q, want %d", step.name, step.method, step.path, w.Code, strings.TrimSpace(w.Body.String()), step.want)
+		}
+	}
+}
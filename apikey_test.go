@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	m "final-project/model"
+)
+
+func TestAPIKeyScopes(t *testing.T) {
+	s := newTestServer(t, nil)
+	admin := s.login(adminEmail, testPassword)
+	s.register("user@example.com")
+	user := s.login("user@example.com", testPassword)
+
+	newKey := func(session tokens, scopes ...string) string {
+		t.Helper()
+		response := s.expect(http.StatusCreated, "POST", "/api-keys", bearer(session.access), m.APIKeyRequest{Name: "test", Scopes: scopes})
+		return response["key"].(string)
+	}
+	accountKey := newKey(admin, m.ScopeAccount)
+	readKey := newKey(admin, m.PermViewUsers)
+	userKey := newKey(user, m.ScopeAccount)
+	detail := fmt.Sprintf("/user/detail/%d", s.userID("user@example.com"))
+
+	tests := []struct {
+		name   string
+		key    string
+		method string
+		path   string
+		want   int
+	}{
+		{"account scope reaches account routes", accountKey, "GET", "/user", http.StatusOK},
+		{"account scope grants no permission", accountKey, "GET", detail, http.StatusForbidden},
+		{"permission scope reaches its route", readKey, "GET", detail, http.StatusOK},
+		{"permission scope lacks the account scope", readKey, "GET", "/user", http.StatusForbidden},
+		{"keys cannot list sessions", accountKey, "GET", "/sessions", http.StatusForbidden},
+		{"keys cannot create keys", accountKey, "POST", "/api-keys", http.StatusForbidden},
+		{"scopes never exceed the role", userKey, "GET", detail, http.StatusForbidden},
+		{"unknown key", "fp_unknown", "GET", "/user", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := s.do(tt.method, tt.path, apiKey(tt.key), nil); w.Code != tt.want {
+				t.Errorf("%s %s = %d %q, want %d", tt.method, tt.path, w.Code, strings.TrimSpace(w.Body.String()), tt.want)
+			}
+		})
+	}
+
+	t.Run("role without the permission", func(t *testing.T) {
+		s.expect(http.StatusForbidden, "POST", "/api-keys", bearer(user.access), m.APIKeyRequest{Name: "test", Scopes: []string{m.PermViewUsers}})
+	})
+}
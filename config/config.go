@@ -0,0 +1,453 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Config holds every setting the server needs at startup.
+type Config struct {
+	Env  string
+	Addr string
+	// StorageDriver selects the repository backend: "mysql", "sqlite" or "memory".
+	StorageDriver string
+	DatabaseDSN   string
+	SQLitePath    string
+
+	DBMaxOpenConns    int
+	DBMaxIdleConns    int
+	DBConnMaxLifetime time.Duration
+	DBConnectTimeout  time.Duration
+	ShutdownTimeout   time.Duration
+	// MigrateOnStart applies pending migrations before serving.
+	MigrateOnStart bool
+
+	// Seed settings used by the seed command and SEED_ON_START.
+	SeedOnStart       bool
+	SeedAdminEmail    string
+	SeedAdminName     string
+	SeedAdminPassword string
+	SeedDemoGames     bool
+
+	// JWTAlgorithm is HS256 (signed with JWTSecret), RS256 or EdDSA. The
+	// asymmetric ones sign with the PEM keys in JWTKeysDir.
+	JWTAlgorithm string
+	JWTSecret    string
+	// JWTIssuer and JWTAudience are set as iss and aud on every token and
+	// required when verifying.
+	JWTIssuer   string
+	JWTAudience string
+	JWTKeysDir  string
+	// JWTActiveKID pins the signing key; by default the newest file signs.
+	JWTActiveKID string
+	// JWTKeyRotation generates a new signing key at this interval and deletes
+	// keys whose tokens have all expired; 0 disables both.
+	JWTKeyRotation time.Duration
+	// TokenTTL is the lifetime of access tokens; clients renew them with a
+	// refresh token, which lives for RefreshTokenTTL.
+	TokenTTL        time.Duration
+	RefreshTokenTTL time.Duration
+	BcryptCost      int
+
+	// Password policy applied when a password is set: at registration,
+	// password reset and password change.
+	PasswordMinLength     int
+	PasswordRequireUpper  bool
+	PasswordRequireLower  bool
+	PasswordRequireDigit  bool
+	PasswordRequireSymbol bool
+	// PasswordRejectCommon refuses passwords from the bundled list of
+	// common and breached passwords.
+	PasswordRejectCommon bool
+
+	// EmailVerification mails new users a link that expires after
+	// EmailVerificationTTL and keeps them from logging in until they open it.
+	EmailVerification    bool
+	EmailVerificationTTL time.Duration
+	// PasswordResetTTL is how long a mailed password reset link works.
+	PasswordResetTTL time.Duration
+	// Mailer is "log" (write messages to the log) or "file" (write one .eml
+	// file per message to MailDir); both are stand-ins for a real provider.
+	Mailer   string
+	MailDir  string
+	MailFrom string
+	// BaseURL is the public address of the API, used in mailed links.
+	BaseURL string
+	// PasswordResetURL is the page that reset emails link to with the token
+	// in the "token" query parameter; it must POST the token and the new
+	// password to /user/password/reset. Without it the email carries the
+	// bare token.
+	PasswordResetURL string
+
+	// TOTPIssuer names the account in authenticator apps.
+	TOTPIssuer string
+	// TwoFactorChallengeTTL is how long the second login step may take.
+	TwoFactorChallengeTTL time.Duration
+	// RequireAdminTwoFactor keeps users of the admin role from using their
+	// permissions until they enable two-factor authentication.
+	RequireAdminTwoFactor bool
+
+	// OIDCIssuer enables login with an OpenID Connect provider; it is the
+	// issuer URL its discovery document is served under. OIDCRedirectURL
+	// defaults to BaseURL + "/user/oidc/callback".
+	OIDCIssuer       string
+	OIDCClientID     string
+	OIDCClientSecret string
+	OIDCRedirectURL  string
+	OIDCScopes       []string
+
+	// DeletedUserReviews is what happens to the reviews of a deleted
+	// account: "anonymize" keeps them as written by "deleted user", "delete"
+	// removes them.
+	DeletedUserReviews string
+
+	CORSOrigins []string
+	LogLevel    string
+}
+
+const defaultJWTSecret = "secret-key"
+
+var defaults = map[string]string{
+	"APP_ENV":                  "development",
+	"HTTP_ADDR":                ":8080",
+	"STORAGE_DRIVER":           "mysql",
+	"DB_DSN":                   "root:@tcp(localhost:3306)/finalprojectdb",
+	"SQLITE_PATH":              "finalprojectdb.sqlite",
+	"DB_MAX_OPEN_CONNS":        "25",
+	"DB_MAX_IDLE_CONNS":        "25",
+	"DB_CONN_MAX_LIFETIME":     "5m",
+	"DB_CONNECT_TIMEOUT":       "30s",
+	"SHUTDOWN_TIMEOUT":         "15s",
+	"MIGRATE_ON_START":         "false",
+	"SEED_ON_START":            "false",
+	"SEED_ADMIN_EMAIL":         "",
+	"SEED_ADMIN_NAME":          "",
+	"SEED_ADMIN_PASSWORD":      "",
+	"SEED_DEMO_GAMES":          "false",
+	"JWT_ALGORITHM":            "HS256",
+	"JWT_SECRET":               defaultJWTSecret,
+	"JWT_ISSUER":               "final-project",
+	"JWT_AUDIENCE":             "final-project",
+	"JWT_KEYS_DIR":             "keys",
+	"JWT_ACTIVE_KID":           "",
+	"JWT_KEY_ROTATION":         "0s",
+	"TOKEN_TTL":                "15m",
+	"REFRESH_TOKEN_TTL":        "720h",
+	"BCRYPT_COST":              strconv.Itoa(bcrypt.DefaultCost),
+	"PASSWORD_MIN_LENGTH":      "8",
+	"PASSWORD_REQUIRE_UPPER":   "false",
+	"PASSWORD_REQUIRE_LOWER":   "false",
+	"PASSWORD_REQUIRE_DIGIT":   "false",
+	"PASSWORD_REQUIRE_SYMBOL":  "false",
+	"PASSWORD_REJECT_COMMON":   "true",
+	"EMAIL_VERIFICATION":       "false",
+	"EMAIL_VERIFICATION_TTL":   "24h",
+	"PASSWORD_RESET_TTL":       "1h",
+	"MAILER":                   "log",
+	"MAIL_DIR":                 "mail",
+	"MAIL_FROM":                "no-reply@localhost",
+	"APP_BASE_URL":             "http://localhost:8080",
+	"PASSWORD_RESET_URL":       "",
+	"TOTP_ISSUER":              "final-project",
+	"TWO_FACTOR_CHALLENGE_TTL": "5m",
+	"REQUIRE_ADMIN_2FA":        "false",
+	"OIDC_ISSUER":              "",
+	"OIDC_CLIENT_ID":           "",
+	"OIDC_CLIENT_SECRET":       "",
+	"OIDC_REDIRECT_URL":        "",
+	"OIDC_SCOPES":              "openid email profile",
+	"DELETED_USER_REVIEWS":     "anonymize",
+	"CORS_ORIGINS":             "",
+	"LOG_LEVEL":                "info",
+}
+
+// Load reads the configuration from defaults, an optional config file and
+// the environment, in that order, and validates the result.
+// The file is taken from CONFIG_FILE, or ".env" in the working directory if present.
+func Load() (*Config, error) {
+	values := make(map[string]string, len(defaults))
+	for key, value := range defaults {
+		values[key] = value
+	}
+
+	path := os.Getenv("CONFIG_FILE")
+	if path == "" {
+		if _, err := os.Stat(".env"); err == nil {
+			path = ".env"
+		}
+	}
+	if path != "" {
+		fileValues, err := readFile(path)
+		if err != nil {
+			return nil, err
+		}
+		for key, value := range fileValues {
+			values[key] = value
+		}
+	}
+
+	for key := range defaults {
+		if value, ok := os.LookupEnv(key); ok {
+			values[key] = value
+		}
+	}
+	// App Engine and most PaaS only provide PORT.
+	if _, ok := os.LookupEnv("HTTP_ADDR"); !ok {
+		if port := os.Getenv("PORT"); port != "" {
+			values["HTTP_ADDR"] = ":" + port
+		}
+	}
+
+	cfg, err := parse(values)
+	if err != nil {
+		return nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+func parse(values map[string]string) (*Config, error) {
+	cfg := &Config{
+		Env:                strings.ToLower(values["APP_ENV"]),
+		Addr:               values["HTTP_ADDR"],
+		StorageDriver:      strings.ToLower(values["STORAGE_DRIVER"]),
+		DatabaseDSN:        values["DB_DSN"],
+		SQLitePath:         values["SQLITE_PATH"],
+		SeedAdminEmail:     values["SEED_ADMIN_EMAIL"],
+		SeedAdminName:      values["SEED_ADMIN_NAME"],
+		SeedAdminPassword:  values["SEED_ADMIN_PASSWORD"],
+		JWTAlgorithm:       values["JWT_ALGORITHM"],
+		JWTSecret:          values["JWT_SECRET"],
+		JWTIssuer:          values["JWT_ISSUER"],
+		JWTAudience:        values["JWT_AUDIENCE"],
+		JWTKeysDir:         values["JWT_KEYS_DIR"],
+		JWTActiveKID:       values["JWT_ACTIVE_KID"],
+		Mailer:             strings.ToLower(values["MAILER"]),
+		MailDir:            values["MAIL_DIR"],
+		MailFrom:           values["MAIL_FROM"],
+		BaseURL:            strings.TrimSuffix(values["APP_BASE_URL"], "/"),
+		PasswordResetURL:   values["PASSWORD_RESET_URL"],
+		TOTPIssuer:         values["TOTP_ISSUER"],
+		OIDCIssuer:         strings.TrimSuffix(values["OIDC_ISSUER"], "/"),
+		OIDCClientID:       values["OIDC_CLIENT_ID"],
+		OIDCClientSecret:   values["OIDC_CLIENT_SECRET"],
+		OIDCRedirectURL:    values["OIDC_REDIRECT_URL"],
+		DeletedUserReviews: strings.ToLower(values["DELETED_USER_REVIEWS"]),
+		LogLevel:           strings.ToLower(values["LOG_LEVEL"]),
+	}
+
+	var err error
+	durations := map[string]*time.Duration{
+		"DB_CONN_MAX_LIFETIME":     &cfg.DBConnMaxLifetime,
+		"DB_CONNECT_TIMEOUT":       &cfg.DBConnectTimeout,
+		"SHUTDOWN_TIMEOUT":         &cfg.ShutdownTimeout,
+		"TOKEN_TTL":                &cfg.TokenTTL,
+		"REFRESH_TOKEN_TTL":        &cfg.RefreshTokenTTL,
+		"JWT_KEY_ROTATION":         &cfg.JWTKeyRotation,
+		"EMAIL_VERIFICATION_TTL":   &cfg.EmailVerificationTTL,
+		"PASSWORD_RESET_TTL":       &cfg.PasswordResetTTL,
+		"TWO_FACTOR_CHALLENGE_TTL": &cfg.TwoFactorChallengeTTL,
+	}
+	for key, dst := range durations {
+		if *dst, err = time.ParseDuration(values[key]); err != nil {
+			return nil, fmt.Errorf("config: %s: %w", key, err)
+		}
+	}
+	ints := map[string]*int{
+		"DB_MAX_OPEN_CONNS":   &cfg.DBMaxOpenConns,
+		"DB_MAX_IDLE_CONNS":   &cfg.DBMaxIdleConns,
+		"BCRYPT_COST":         &cfg.BcryptCost,
+		"PASSWORD_MIN_LENGTH": &cfg.PasswordMinLength,
+	}
+	for key, dst := range ints {
+		if *dst, err = strconv.Atoi(values[key]); err != nil {
+			return nil, fmt.Errorf("config: %s: %w", key, err)
+		}
+	}
+	bools := map[string]*bool{
+		"MIGRATE_ON_START":        &cfg.MigrateOnStart,
+		"SEED_ON_START":           &cfg.SeedOnStart,
+		"SEED_DEMO_GAMES":         &cfg.SeedDemoGames,
+		"EMAIL_VERIFICATION":      &cfg.EmailVerification,
+		"PASSWORD_REQUIRE_UPPER":  &cfg.PasswordRequireUpper,
+		"PASSWORD_REQUIRE_LOWER":  &cfg.PasswordRequireLower,
+		"PASSWORD_REQUIRE_DIGIT":  &cfg.PasswordRequireDigit,
+		"PASSWORD_REQUIRE_SYMBOL": &cfg.PasswordRequireSymbol,
+		"PASSWORD_REJECT_COMMON":  &cfg.PasswordRejectCommon,
+		"REQUIRE_ADMIN_2FA":       &cfg.RequireAdminTwoFactor,
+	}
+	for key, dst := range bools {
+		if *dst, err = strconv.ParseBool(values[key]); err != nil {
+			return nil, fmt.Errorf("config: %s: %w", key, err)
+		}
+	}
+	// Config files join YAML lists with commas; the environment uses spaces.
+	cfg.OIDCScopes = strings.FieldsFunc(values["OIDC_SCOPES"], func(r rune) bool {
+		return r == ',' || unicode.IsSpace(r)
+	})
+	if cfg.OIDCRedirectURL == "" {
+		cfg.OIDCRedirectURL = cfg.BaseURL + "/user/oidc/callback"
+	}
+	for _, origin := range strings.Split(values["CORS_ORIGINS"], ",") {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			cfg.CORSOrigins = append(cfg.CORSOrigins, origin)
+		}
+	}
+	return cfg, nil
+}
+
+// Validate reports every invalid setting at once.
+func (cfg *Config) Validate() error {
+	var errs []error
+	switch cfg.Env {
+	case "development", "staging", "production":
+	default:
+		errs = append(errs, fmt.Errorf("APP_ENV must be development, staging or production, got %q", cfg.Env))
+	}
+	if cfg.Addr == "" {
+		errs = append(errs, errors.New("HTTP_ADDR must not be empty"))
+	}
+	switch cfg.StorageDriver {
+	case "mysql":
+		if cfg.DatabaseDSN == "" {
+			errs = append(errs, errors.New("DB_DSN must not be empty"))
+		}
+	case "sqlite":
+		if cfg.SQLitePath == "" {
+			errs = append(errs, errors.New("SQLITE_PATH must not be empty"))
+		}
+	case "memory":
+	default:
+		errs = append(errs, fmt.Errorf("STORAGE_DRIVER must be mysql, sqlite or memory, got %q", cfg.StorageDriver))
+	}
+	if cfg.DBMaxOpenConns < 0 || cfg.DBMaxIdleConns < 0 {
+		errs = append(errs, errors.New("DB_MAX_OPEN_CONNS and DB_MAX_IDLE_CONNS must not be negative"))
+	}
+	if cfg.DBConnMaxLifetime < 0 {
+		errs = append(errs, errors.New("DB_CONN_MAX_LIFETIME must not be negative"))
+	}
+	if cfg.DBConnectTimeout <= 0 {
+		errs = append(errs, errors.New("DB_CONNECT_TIMEOUT must be positive"))
+	}
+	if cfg.ShutdownTimeout <= 0 {
+		errs = append(errs, errors.New("SHUTDOWN_TIMEOUT must be positive"))
+	}
+	if cfg.SeedAdminEmail != "" && cfg.SeedAdminPassword == "" {
+		errs = append(errs, errors.New("SEED_ADMIN_PASSWORD is required when SEED_ADMIN_EMAIL is set"))
+	}
+	switch cfg.JWTAlgorithm {
+	case "HS256":
+		if cfg.JWTSecret == "" {
+			errs = append(errs, errors.New("JWT_SECRET must not be empty"))
+		}
+		if cfg.Env != "development" && (cfg.JWTSecret == defaultJWTSecret || len(cfg.JWTSecret) < 32) {
+			errs = append(errs, errors.New("JWT_SECRET must be set to at least 32 characters outside development"))
+		}
+	case "RS256", "EdDSA":
+		if cfg.JWTKeysDir == "" {
+			errs = append(errs, errors.New("JWT_KEYS_DIR must not be empty"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("JWT_ALGORITHM must be HS256, RS256 or EdDSA, got %q", cfg.JWTAlgorithm))
+	}
+	if cfg.JWTIssuer == "" || cfg.JWTAudience == "" {
+		errs = append(errs, errors.New("JWT_ISSUER and JWT_AUDIENCE must not be empty"))
+	}
+	if cfg.JWTKeyRotation < 0 {
+		errs = append(errs, errors.New("JWT_KEY_ROTATION must not be negative"))
+	}
+	if cfg.JWTKeyRotation > 0 && cfg.JWTActiveKID != "" {
+		errs = append(errs, errors.New("JWT_ACTIVE_KID cannot be combined with JWT_KEY_ROTATION"))
+	}
+	if cfg.TokenTTL <= 0 {
+		errs = append(errs, errors.New("TOKEN_TTL must be positive"))
+	}
+	if cfg.RefreshTokenTTL < cfg.TokenTTL {
+		errs = append(errs, errors.New("REFRESH_TOKEN_TTL must not be shorter than TOKEN_TTL"))
+	}
+	if cfg.BcryptCost < bcrypt.MinCost || cfg.BcryptCost > bcrypt.MaxCost {
+		errs = append(errs, fmt.Errorf("BCRYPT_COST must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost))
+	}
+	// bcrypt ignores everything past 72 bytes.
+	if cfg.PasswordMinLength < 8 || cfg.PasswordMinLength > 72 {
+		errs = append(errs, errors.New("PASSWORD_MIN_LENGTH must be between 8 and 72"))
+	}
+	if cfg.EmailVerificationTTL <= 0 {
+		errs = append(errs, errors.New("EMAIL_VERIFICATION_TTL must be positive"))
+	}
+	if cfg.PasswordResetTTL <= 0 {
+		errs = append(errs, errors.New("PASSWORD_RESET_TTL must be positive"))
+	}
+	switch cfg.Mailer {
+	case "log":
+	case "file":
+		if cfg.MailDir == "" {
+			errs = append(errs, errors.New("MAIL_DIR must not be empty"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("MAILER must be log or file, got %q", cfg.Mailer))
+	}
+	if cfg.MailFrom == "" {
+		errs = append(errs, errors.New("MAIL_FROM must not be empty"))
+	}
+	if cfg.BaseURL == "" {
+		errs = append(errs, errors.New("APP_BASE_URL must not be empty"))
+	}
+	if cfg.PasswordResetURL != "" {
+		if u, err := url.Parse(cfg.PasswordResetURL); err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			errs = append(errs, errors.New("PASSWORD_RESET_URL must be an http or https URL"))
+		}
+	}
+	if cfg.TOTPIssuer == "" || strings.Contains(cfg.TOTPIssuer, ":") {
+		errs = append(errs, errors.New("TOTP_ISSUER must not be empty or contain a colon"))
+	}
+	if cfg.TwoFactorChallengeTTL <= 0 {
+		errs = append(errs, errors.New("TWO_FACTOR_CHALLENGE_TTL must be positive"))
+	}
+	if cfg.OIDCIssuer != "" {
+		if u, err := url.Parse(cfg.OIDCIssuer); err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			errs = append(errs, errors.New("OIDC_ISSUER must be an http or https URL"))
+		} else if u.Scheme != "https" && cfg.Env != "development" {
+			errs = append(errs, errors.New("OIDC_ISSUER must use https outside development"))
+		}
+		if cfg.OIDCClientID == "" {
+			errs = append(errs, errors.New("OIDC_CLIENT_ID is required when OIDC_ISSUER is set"))
+		}
+		if !slices.Contains(cfg.OIDCScopes, "openid") {
+			errs = append(errs, errors.New("OIDC_SCOPES must include openid"))
+		}
+	}
+	switch cfg.DeletedUserReviews {
+	case "anonymize", "delete":
+	default:
+		errs = append(errs, fmt.Errorf("DELETED_USER_REVIEWS must be anonymize or delete, got %q", cfg.DeletedUserReviews))
+	}
+	if _, err := cfg.SlogLevel(); err != nil {
+		errs = append(errs, err)
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("config: %w", errors.Join(errs...))
+	}
+	return nil
+}
+
+// SlogLevel converts LogLevel into a slog.Level.
+func (cfg *Config) SlogLevel() (slog.Level, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(cfg.LogLevel)); err != nil {
+		return level, fmt.Errorf("LOG_LEVEL must be debug, info, warn or error, got %q", cfg.LogLevel)
+	}
+	return level, nil
+}
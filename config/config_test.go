@@ -0,0 +1,53 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestLoadFileOIDCScopes(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		want    []string
+	}{
+		{
+			name:    "yaml list",
+			file:    "config.yaml",
+			content: "oidc_issuer: http://localhost:9000\noidc_client_id: api\noidc_scopes: [openid, email]\n",
+			want:    []string{"openid", "email"},
+		},
+		{
+			name:    "yaml string",
+			file:    "config.yml",
+			content: "oidc_issuer: http://localhost:9000\noidc_client_id: api\noidc_scopes: openid profile\n",
+			want:    []string{"openid", "profile"},
+		},
+		{
+			name:    "env file with commas",
+			file:    "app.env",
+			content: "OIDC_ISSUER=http://localhost:9000\nOIDC_CLIENT_ID=api\nOIDC_SCOPES=\"openid, email,profile\"\n",
+			want:    []string{"openid", "email", "profile"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), tt.file)
+			if err := os.WriteFile(path, []byte(tt.content), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			t.Setenv("CONFIG_FILE", path)
+
+			cfg, err := Load()
+			if err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+			if !slices.Equal(cfg.OIDCScopes, tt.want) {
+				t.Errorf("OIDCScopes = %q, want %q", cfg.OIDCScopes, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// readFile loads a flat key/value file. Files ending in .yaml or .yml are
+// parsed as YAML, anything else as KEY=VALUE lines.
+// Keys are upper-cased so "db_dsn:" in YAML matches the DB_DSN variable.
+func readFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("config: %w", err)
+	}
+
+	values := make(map[string]string)
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		var raw map[string]interface{}
+		if err := yaml.Unmarshal(data, &raw); err != nil {
+			return nil, fmt.Errorf("config: %s: %w", path, err)
+		}
+		for key, value := range raw {
+			switch v := value.(type) {
+			case []interface{}:
+				items := make([]string, len(v))
+				for i, item := range v {
+					items[i] = fmt.Sprint(item)
+				}
+				values[strings.ToUpper(key)] = strings.Join(items, ",")
+			default:
+				values[strings.ToUpper(key)] = fmt.Sprint(v)
+			}
+		}
+	default:
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		for line := 1; scanner.Scan(); line++ {
+			text := strings.TrimSpace(scanner.Text())
+			if text == "" || strings.HasPrefix(text, "#") {
+				continue
+			}
+			text = strings.TrimPrefix(text, "export ")
+			key, value, ok := strings.Cut(text, "=")
+			if !ok {
+				return nil, fmt.Errorf("config: %s:%d: expected KEY=VALUE", path, line)
+			}
+			value = strings.TrimSpace(value)
+			if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+				value = value[1 : len(value)-1]
+			}
+			values[strings.ToUpper(strings.TrimSpace(key))] = value
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("config: %s: %w", path, err)
+		}
+	}
+	return values, nil
+}
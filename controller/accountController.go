@@ -0,0 +1,140 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	m "final-project/model"
+	"final-project/repository"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// @Summary Export own account
+// @Description Download everything stored about the authenticated user: profile, reviews and wishlist
+// @Security ApiKeyAuth
+// @Success 200 {object} m.AccountExport "Account export"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Router /user/me/export [get]
+func (ctl *Controller) ExportAccount(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	export, err := ctl.accountExport(r.Context(), principal(r).User)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", `attachment; filename="account-export.json"`)
+	json.NewEncoder(w).Encode(export)
+}
+
+// @Summary Delete own account
+// @Description Delete the authenticated user after confirming the password, and the TOTP or recovery code when two-factor authentication is enabled. The wishlist is deleted; reviews are anonymized or deleted as DELETED_USER_REVIEWS says. The response carries a last export of the account.
+// @Security ApiKeyAuth
+// @Param request body m.DeleteAccountRequest true "Password, and code when two-factor authentication is enabled"
+// @Success 200 {object} map[string]interface{} "Account deleted" (with the export as m.AccountExport)
+// @Failure 400 {object} map[string]string "Invalid request body / Invalid code"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 403 {object} map[string]string "Current password is incorrect"
+// @Failure 409 {object} map[string]string "You are the last user who can manage users; give that permission to another user first"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Router /user/me [delete]
+func (ctl *Controller) DeleteAccount(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	var request m.DeleteAccountRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	user := principal(r).User
+	if bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(request.Password)) != nil {
+		http.Error(w, "Current password is incorrect", http.StatusForbidden)
+		return
+	}
+	if user.TwoFactorEnabled {
+		ok, err := ctl.verifySecondFactor(r.Context(), user, request.Code)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !ok {
+			http.Error(w, "Invalid code", http.StatusBadRequest)
+			return
+		}
+	}
+	last, err := ctl.isLastAdmin(r.Context(), user)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if last {
+		http.Error(w, "You are the last user who can manage users; give that permission to another user first", http.StatusConflict)
+		return
+	}
+
+	export, err := ctl.accountExport(r.Context(), user)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// Sessions, refresh tokens, API keys and linked identities go with the
+	// row, so every credential of the account stops working at once.
+	err = ctl.users.Delete(r.Context(), user.ID, ctl.opts.AnonymizeReviews)
+	if errors.Is(err, repository.ErrNotFound) {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	slog.Info("Account deleted by its user", "user_id", user.ID, "anonymized_reviews", ctl.opts.AnonymizeReviews)
+
+	response := map[string]interface{}{
+		"message": "Account deleted",
+		"export":  export,
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func (ctl *Controller) accountExport(ctx context.Context, user m.User) (m.AccountExport, error) {
+	reviews, err := ctl.reviews.ListByUser(ctx, user.ID)
+	if err != nil {
+		return m.AccountExport{}, err
+	}
+	wishlist, err := ctl.wishlists.ListByUser(ctx, user.ID)
+	if err != nil {
+		return m.AccountExport{}, err
+	}
+	if reviews == nil {
+		reviews = []m.Review{}
+	}
+	if wishlist == nil {
+		wishlist = []m.WishlistWithGameTitle{}
+	}
+	return m.AccountExport{
+		ExportedAt: m.NewMySQLTime(time.Now()),
+		User:       m.NewSelfUser(user),
+		Reviews:    reviews,
+		Wishlist:   wishlist,
+	}, nil
+}
+
+// isLastAdmin reports whether user is the only one left whose role may
+// manage users, so losing them would leave nobody able to.
+func (ctl *Controller) isLastAdmin(ctx context.Context, user m.User) (bool, error) {
+	manager, err := ctl.permissions.HasPermission(ctx, user.RoleId, m.PermManageUsers)
+	if err != nil || !manager {
+		return false, err
+	}
+	count, err := ctl.users.CountWithPermission(ctx, m.PermManageUsers)
+	if err != nil {
+		return false, err
+	}
+	return count <= 1, nil
+}
@@ -0,0 +1,185 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	h "final-project/helper"
+	m "final-project/model"
+	"final-project/repository"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+const (
+	// apiKeyPrefix marks the keys of this API so leaked ones are easy to
+	// search for.
+	apiKeyPrefix = "fpk_"
+	// apiKeyShownLength is how much of a key is stored in clear to tell keys
+	// apart in listings.
+	apiKeyShownLength    = 12
+	maxAPIKeyNameLength  = 100
+	defaultAPIKeyTTLDays = 90
+	maxAPIKeyTTLDays     = 365
+)
+
+// @Summary List API keys
+// @Description List the API keys of the authenticated user that are not revoked. The keys themselves are never shown again.
+// @Security ApiKeyAuth
+// @Success 200 {object} []m.APIKey "List of API keys"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 403 {object} map[string]string "API keys cannot be used here; sign in instead"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Router /api-keys [get]
+func (ctl *Controller) GetAPIKeys(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	keys, err := ctl.apiKeys.ListByUser(r.Context(), principal(r).User.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(keys)
+}
+
+// @Summary Create API key
+// @Description Create a named API key for scripts, sent in the X-API-Key header. Scopes are "account" for routes that need no permission, or permission names the caller's role has. The key is only returned in this response.
+// @Security ApiKeyAuth
+// @Param request body m.APIKeyRequest true "Name, scopes and lifetime in days (default 90, at most 365)"
+// @Success 201 {object} map[string]interface{} "API key created"
+// @Failure 400 {object} map[string]string "Invalid request body / Unknown scope"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 403 {object} map[string]string "Your role does not have the requested scope"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Router /api-keys [post]
+func (ctl *Controller) CreateAPIKey(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	var request m.APIKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	caller := principal(r)
+	name := strings.TrimSpace(request.Name)
+	if name == "" {
+		http.Error(w, "Name must not be empty", http.StatusBadRequest)
+		return
+	}
+	if utf8.RuneCountInString(name) > maxAPIKeyNameLength {
+		http.Error(w, "Name should be at most 100 characters", http.StatusBadRequest)
+		return
+	}
+	days := request.ExpiresInDays
+	if days == 0 {
+		days = defaultAPIKeyTTLDays
+	}
+	if days < 0 || days > maxAPIKeyTTLDays {
+		http.Error(w, "expires_in_days must be between 1 and 365", http.StatusBadRequest)
+		return
+	}
+	if len(request.Scopes) == 0 {
+		http.Error(w, "At least one scope is required", http.StatusBadRequest)
+		return
+	}
+
+	scopes := m.Scopes{}
+	for _, scope := range request.Scopes {
+		if scopes.Has(scope) {
+			continue
+		}
+		if scope != m.ScopeAccount {
+			if !knownPermission(scope) {
+				http.Error(w, fmt.Sprintf("Unknown scope %q", scope), http.StatusBadRequest)
+				return
+			}
+			// A key never grants more than its owner has right now; the
+			// Authorizer checks the role again on every request.
+			granted, err := ctl.permissions.HasPermission(r.Context(), caller.User.RoleId, scope)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			if !granted {
+				http.Error(w, fmt.Sprintf("Your role does not have %q", scope), http.StatusForbidden)
+				return
+			}
+		}
+		scopes = append(scopes, scope)
+	}
+
+	secret, err := h.RandomToken(32)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	plaintext := apiKeyPrefix + secret
+	now := time.Now()
+	key := m.APIKey{
+		UserID:    caller.User.ID,
+		Name:      name,
+		Prefix:    plaintext[:apiKeyShownLength],
+		KeyHash:   h.HashToken(plaintext),
+		Scopes:    scopes,
+		ExpiresAt: m.NewMySQLTime(now.AddDate(0, 0, days)),
+		CreatedAt: m.NewMySQLTime(now),
+	}
+	if err := ctl.apiKeys.Create(r.Context(), &key); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	response := map[string]interface{}{
+		"message": "API key created; copy it now, it will not be shown again",
+		"key":     plaintext,
+		"api_key": key,
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(response)
+}
+
+// @Summary Revoke API key
+// @Description Revoke one of the authenticated user's API keys
+// @Security ApiKeyAuth
+// @Param id path int true "API key ID"
+// @Success 200 {object} map[string]string "API key revoked"
+// @Failure 400 {object} map[string]string "Invalid API key ID"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 404 {object} map[string]string "API key not found"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Router /api-key/{id} [delete]
+func (ctl *Controller) RevokeAPIKey(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	keyID, err := strconv.Atoi(ps.ByName("id"))
+	if err != nil {
+		http.Error(w, "Invalid API key ID", http.StatusBadRequest)
+		return
+	}
+	err = ctl.apiKeys.Revoke(r.Context(), keyID, principal(r).User.ID)
+	if errors.Is(err, repository.ErrNotFound) {
+		http.Error(w, "API key not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	response := map[string]string{
+		"message": "API key revoked",
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func knownPermission(name string) bool {
+	for _, permission := range m.Permissions {
+		if permission.Name == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,103 @@
+package controller
+
+import (
+	"context"
+	h "final-project/helper"
+	"final-project/mailer"
+	"final-project/oidc"
+	"final-project/repository"
+	"net/http"
+	"sync"
+)
+
+// Controller holds the dependencies shared by every HTTP handler.
+type Controller struct {
+	users          repository.UserRepository
+	roles          repository.RoleRepository
+	permissions    repository.PermissionRepository
+	refreshTokens  repository.RefreshTokenRepository
+	sessions       repository.SessionRepository
+	passwordResets repository.PasswordResetRepository
+	recoveryCodes  repository.RecoveryCodeRepository
+	apiKeys        repository.APIKeyRepository
+	identities     repository.IdentityRepository
+	games          repository.GameRepository
+	reviews        repository.ReviewRepository
+	wishlists      repository.WishlistRepository
+	opts           Options
+	// challengeAttempts counts the codes tried per login challenge and
+	// userAttempts the codes tried per user.
+	challengeAttempts *attemptCounter
+	userAttempts      *attemptCounter
+	// background tracks the mails sent after the response is written.
+	background sync.WaitGroup
+}
+
+// Options configures the account features that are not backed by a
+// repository.
+type Options struct {
+	Mailer mailer.Mailer
+	// RequireVerifiedEmail mails new users a verification link and refuses
+	// to log in users that have not opened it.
+	RequireVerifiedEmail bool
+	// BaseURL is the public address of the API, used in mailed links.
+	BaseURL string
+	// PasswordResetURL is the frontend page reset emails link to; empty
+	// mails the bare token.
+	PasswordResetURL string
+	// RequireAdminTwoFactor keeps admins from disabling two-factor
+	// authentication; the Authorizer denies them until they enable it.
+	RequireAdminTwoFactor bool
+	// OIDC is the identity provider for GET /user/oidc/login; nil disables
+	// the OIDC endpoints.
+	OIDC *oidc.Provider
+	// AnonymizeReviews keeps the reviews of deleted users as written by
+	// "deleted user" instead of deleting them.
+	AnonymizeReviews bool
+	// Authorizer answers the permission checks made inside handlers, such as
+	// a moderator deleting another user's review.
+	Authorizer Authorizer
+}
+
+// Authorizer decides whether a principal may use a permission, the same way
+// the routes guarded by the middleware do.
+type Authorizer interface {
+	Allows(ctx context.Context, principal *h.Principal, permission string) (bool, error)
+}
+
+func New(repos *repository.Repositories, opts Options) *Controller {
+	return &Controller{
+		users:             repos.Users,
+		roles:             repos.Roles,
+		permissions:       repos.Permissions,
+		refreshTokens:     repos.RefreshTokens,
+		sessions:          repos.Sessions,
+		passwordResets:    repos.PasswordResets,
+		recoveryCodes:     repos.RecoveryCodes,
+		apiKeys:           repos.APIKeys,
+		identities:        repos.Identities,
+		games:             repos.Games,
+		reviews:           repos.Reviews,
+		wishlists:         repos.Wishlists,
+		opts:              opts,
+		challengeAttempts: newAttemptCounter(),
+		userAttempts:      newAttemptCounter(),
+	}
+}
+
+// Wait blocks until the mails sent in the background have gone out. Call it
+// after the server has shut down so none are lost.
+func (ctl *Controller) Wait() {
+	ctl.background.Wait()
+}
+
+// principal returns the caller stored by the authentication middleware.
+// Every handler that calls it must be registered behind Authenticator.Require,
+// Authenticator.RequireSession or Authorizer.Require.
+func principal(r *http.Request) *h.Principal {
+	p, ok := h.PrincipalFromContext(r.Context())
+	if !ok {
+		panic("controller: route is missing the authentication middleware")
+	}
+	return p
+}
@@ -1,11 +1,10 @@
 package controller
 
 import (
-	"database/sql"
 	"encoding/json"
-	d "final-project/db"
-	h "final-project/helper"
+	"errors"
 	m "final-project/model"
+	"final-project/repository"
 	"net/http"
 	"strconv"
 	"time"
@@ -26,7 +25,7 @@ import (
 // @Failure 400 {object} map[string]string "Invalid Release Date format. Use 'YYYY-MM-DD'." (when the provided Release Date has an invalid format)
 // @Failure 500 {object} map[string]string "Internal server error" (when there is a problem with the database)
 // @Router /games [post]
-func AddGame(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+func (ctl *Controller) AddGame(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 	var game m.Game
 	if err := json.NewDecoder(r.Body).Decode(&game); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
@@ -34,44 +33,23 @@ func AddGame(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 	}
 	defer r.Body.Close()
 
-	claims, err := h.Authenticate(r)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusUnauthorized)
-		return
-	}
-
-	// Check if the role claim exists and is equal to 2 (admin role)
-	if role, ok := claims["role"].(float64); !ok || role != 2 {
-		http.Error(w, "Access denied", http.StatusForbidden)
-		return
-	}
-
 	if game.Title == "" || game.Developer == "" || game.Description == "" {
 		http.Error(w, "Fill all the blank!", http.StatusBadRequest)
 		return
 	}
 	createdAt := m.NewMySQLTime(time.Now())
-	releaseDate, err := time.Parse("2006-01-02", game.ReleaseDate)
-	if err != nil {
+	if _, err := time.Parse("2006-01-02", game.ReleaseDate); err != nil {
 		http.Error(w, "Invalid Release Date format. Use 'YYYY-MM-DD'.", http.StatusBadRequest)
 		return
 	}
-	result, err := d.Db.Exec("INSERT INTO games (title, developer, release_date, description, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?)",
-		game.Title, game.Developer, releaseDate, game.Description, createdAt, createdAt)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-	gameID, err := result.LastInsertId()
+	game.CreatedAt = createdAt
+	game.UpdatedAt = createdAt
+	err := ctl.games.Create(r.Context(), &game)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	game.ID = int(gameID)
-	game.CreatedAt = createdAt
-	game.UpdatedAt = createdAt
-
 	response := map[string]interface{}{
 		"message": "Game added",
 		"game":    game,
@@ -87,20 +65,15 @@ func AddGame(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 // @Success 200 {object} []m.GameResponse "List of game titles" // Sesuaikan dengan tipe m.GameResponse
 // @Failure 500 {object} map[string]string "Internal server error" (when there is a problem with the database)
 // @Router /games [get]
-func GetGames(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
-	rows, err := d.Db.Query("SELECT title from games")
+func (ctl *Controller) GetGames(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	stored, err := ctl.games.List(r.Context())
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 	var games []m.GameResponse
-	for rows.Next() {
-		var game m.GameResponse
-		if err := rows.Scan(&game.Title); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
-		games = append(games, game)
+	for _, game := range stored {
+		games = append(games, m.GameResponse{Title: game.Title})
 	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(games)
@@ -115,16 +88,14 @@ func GetGames(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 // @Failure 404 {object} map[string]string "Game not found" (when the requested game ID does not exist in the database)
 // @Failure 500 {object} map[string]string "Internal server error" (when there is a problem with the database)
 // @Router /games/{id} [get]
-func GetGameDetail(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+func (ctl *Controller) GetGameDetail(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	gameID, err := strconv.Atoi(ps.ByName("id"))
 	if err != nil {
 		http.Error(w, "Invalid id", http.StatusBadRequest)
 		return
 	}
-	var existingGame m.Game
-	err = d.Db.QueryRow("SELECT id, title, developer, release_date, description, created_at, updated_at from games WHERE id = ?", gameID).
-		Scan(&existingGame.ID, &existingGame.Title, &existingGame.Developer, &existingGame.ReleaseDate, &existingGame.Description, &existingGame.CreatedAt, &existingGame.UpdatedAt)
-	if err != sql.ErrNoRows {
+	existingGame, err := ctl.games.GetByID(r.Context(), gameID)
+	if errors.Is(err, repository.ErrNotFound) {
 		http.Error(w, "Game not found", http.StatusNotFound)
 		return
 	} else if err != nil {
@@ -147,39 +118,20 @@ func GetGameDetail(w http.ResponseWriter, r *http.Request, ps httprouter.Params)
 // @Failure 404 {object} map[string]string "Game not found" (when the requested game ID does not exist in the database)
 // @Failure 500 {object} map[string]string "Internal server error" (when there is a problem with the database)
 // @Router /games/{id} [delete]
-func DeleteGame(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
-	claims, err := h.Authenticate(r)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusUnauthorized)
-		return
-	}
-
-	// Check if the role claim exists and is equal to 2 (admin role)
-	if role, ok := claims["role"].(float64); !ok || role != 2 {
-		http.Error(w, "Access denied", http.StatusForbidden)
-		return
-	}
+func (ctl *Controller) DeleteGame(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	gameID, err := strconv.Atoi(ps.ByName("id"))
 	if err != nil {
 		http.Error(w, "Invalid game id", http.StatusBadRequest)
 		return
 	}
-	var existingGame m.Game
-	err = d.Db.QueryRow("SELECT id, title, developer, release_date, description, created_at, updated_at from games WHERE id = ?", gameID).
-		Scan(&existingGame.ID, &existingGame.Title, &existingGame.Developer, &existingGame.ReleaseDate, &existingGame.Description, &existingGame.CreatedAt, &existingGame.UpdatedAt)
-	if err == sql.ErrNoRows {
+	err = ctl.games.Delete(r.Context(), gameID)
+	if errors.Is(err, repository.ErrNotFound) {
 		http.Error(w, "Game not found", http.StatusNotFound)
 		return
 	} else if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-
-	_, err = d.Db.Exec("DELETE FROM games WHERE id = ?", gameID)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
 	response := map[string]string{
 		"message": "Game successfully deleted",
 	}
@@ -204,18 +156,7 @@ func DeleteGame(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 // @Failure 404 {object} map[string]string "Game not found" (when the requested game ID does not exist in the database)
 // @Failure 500 {object} map[string]string "Internal server error" (when there is a problem with the database)
 // @Router /games/{id} [post]
-func UpdateGame(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
-	// Authenticate and extract UserID from JWT
-	claims, err := h.Authenticate(r)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusUnauthorized)
-		return
-	}
-	// Check if the role claim exists and is equal to 2 (admin role)
-	if role, ok := claims["role"].(float64); !ok || role != 2 {
-		http.Error(w, "Access denied", http.StatusForbidden)
-		return
-	}
+func (ctl *Controller) UpdateGame(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	gameID, err := strconv.Atoi(ps.ByName("id"))
 	if err != nil {
 		http.Error(w, "Invalid game id", http.StatusBadRequest)
@@ -223,16 +164,14 @@ func UpdateGame(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	}
 	defer r.Body.Close()
 
-	var existingGame m.Game
 	var game m.Game
 	if err := json.NewDecoder(r.Body).Decode(&game); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	err = d.Db.QueryRow("SELECT id, title, developer, release_date, description, updated_at from games WHERE id = ?", gameID).
-		Scan(&existingGame.ID, &existingGame.Title, &existingGame.Developer, &existingGame.ReleaseDate, &existingGame.Description, &existingGame.UpdatedAt)
-	if err == sql.ErrNoRows {
+	existingGame, err := ctl.games.GetByID(r.Context(), gameID)
+	if errors.Is(err, repository.ErrNotFound) {
 		http.Error(w, "Game not found", http.StatusNotFound)
 		return
 	} else if err != nil {
@@ -242,8 +181,9 @@ func UpdateGame(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 
 	createdAt := m.NewMySQLTime(time.Now())
 
-	_, err = d.Db.Exec("UPDATE games SET title = ?, developer = ?, release_date = ?, description = ?, updated_at = ? WHERE id = ?",
-		game.Title, game.Developer, game.ReleaseDate, game.Description, createdAt, gameID)
+	game.ID = gameID
+	game.UpdatedAt = createdAt
+	err = ctl.games.Update(r.Context(), game)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
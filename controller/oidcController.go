@@ -0,0 +1,225 @@
+package controller
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	h "final-project/helper"
+	m "final-project/model"
+	"final-project/oidc"
+	"final-project/repository"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// oidcStateCookie keeps the signed login state between the redirect to the
+// provider and the callback.
+const oidcStateCookie = "oidc_state"
+
+var (
+	errProviderEmailUnverified = errors.New("The identity provider has not verified your email address")
+	errLocalEmailUnverified    = errors.New("An account with this email address exists but its address is not verified; verify it or reset the password first")
+)
+
+// @Summary Log in with OpenID Connect
+// @Description Redirect to the configured identity provider (authorization code flow with PKCE). After signing in there the browser returns to GET /user/oidc/callback.
+// @Param login_hint query string false "Email address to suggest to the identity provider"
+// @Success 302 {string} string "Redirect to the identity provider"
+// @Failure 404 {object} map[string]string "OIDC login is not configured"
+// @Failure 502 {object} map[string]string "Identity provider is unavailable"
+// @Router /user/oidc/login [get]
+func (ctl *Controller) OIDCLogin(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	provider := ctl.opts.OIDC
+	if provider == nil {
+		http.Error(w, "OIDC login is not configured", http.StatusNotFound)
+		return
+	}
+	state, err := h.RandomToken(16)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	nonce, err := h.RandomToken(16)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	verifier, err := oidc.NewVerifier()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	redirect, err := provider.AuthCodeURL(r.Context(), state, nonce, verifier, r.URL.Query().Get("login_hint"))
+	if err != nil {
+		slog.Error("OIDC discovery failed", "issuer", provider.Issuer, "error", err)
+		http.Error(w, "Identity provider is unavailable", http.StatusBadGateway)
+		return
+	}
+	cookie, err := h.CreateOIDCState(state, nonce, verifier)
+	if err != nil {
+		http.Error(w, "Failed to create JWT token", http.StatusInternalServerError)
+		return
+	}
+	http.SetCookie(w, ctl.oidcCookie(cookie, int(h.OIDCStateTTL().Seconds())))
+	http.Redirect(w, r, redirect, http.StatusFound)
+}
+
+// @Summary OpenID Connect callback
+// @Description Finish a login started at GET /user/oidc/login. The identity is linked to the user with the same verified email address, or a user with the default role is created. Responds like POST /user/login.
+// @Param code query string true "Authorization code"
+// @Param state query string true "State sent to the identity provider"
+// @Success 200 {object} map[string]interface{} "Login successful, or a challenge_token when two-factor authentication is enabled"
+// @Failure 400 {object} map[string]string "Invalid or expired login state"
+// @Failure 401 {object} map[string]string "OIDC login failed" (when the provider refused the login or its ID token is invalid)
+// @Failure 403 {object} map[string]string "The identity provider has not verified your email address"
+// @Failure 404 {object} map[string]string "OIDC login is not configured"
+// @Failure 409 {object} map[string]string "An account with this email address exists but its address is not verified"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Router /user/oidc/callback [get]
+func (ctl *Controller) OIDCCallback(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	provider := ctl.opts.OIDC
+	if provider == nil {
+		http.Error(w, "OIDC login is not configured", http.StatusNotFound)
+		return
+	}
+	query := r.URL.Query()
+	cookie, err := r.Cookie(oidcStateCookie)
+	if err != nil {
+		http.Error(w, "Invalid or expired login state", http.StatusBadRequest)
+		return
+	}
+	// The state is single use whatever happens next.
+	http.SetCookie(w, ctl.oidcCookie("", -1))
+	state, err := h.ParseOIDCState(cookie.Value)
+	if err != nil || subtle.ConstantTimeCompare([]byte(state.State), []byte(query.Get("state"))) != 1 {
+		http.Error(w, "Invalid or expired login state", http.StatusBadRequest)
+		return
+	}
+	if providerError := query.Get("error"); providerError != "" {
+		slog.Info("OIDC login refused by the provider", "error", providerError)
+		http.Error(w, "OIDC login failed", http.StatusUnauthorized)
+		return
+	}
+
+	identity, err := provider.Exchange(r.Context(), query.Get("code"), state.Verifier, state.Nonce)
+	if err != nil {
+		slog.Warn("OIDC code exchange failed", "issuer", provider.Issuer, "error", err)
+		http.Error(w, "OIDC login failed", http.StatusUnauthorized)
+		return
+	}
+
+	user, err := ctl.userForIdentity(r.Context(), identity)
+	switch {
+	case errors.Is(err, errProviderEmailUnverified):
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	case errors.Is(err, errLocalEmailUnverified), errors.Is(err, repository.ErrDuplicate):
+		http.Error(w, errLocalEmailUnverified.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	ctl.startLogin(w, r, user)
+}
+
+// userForIdentity returns the user linked to identity. An identity seen
+// for the first time is linked to the user with the same email address, as
+// long as both sides have verified it, or to a new user with the default
+// role.
+func (ctl *Controller) userForIdentity(ctx context.Context, identity *oidc.Identity) (m.User, error) {
+	linked, err := ctl.identities.GetBySubject(ctx, identity.Issuer, identity.Subject)
+	if err == nil {
+		return ctl.users.GetByID(ctx, linked.UserID)
+	} else if !errors.Is(err, repository.ErrNotFound) {
+		return m.User{}, err
+	}
+
+	if !identity.EmailVerified || !h.IsValidEmail(identity.Email) {
+		return m.User{}, errProviderEmailUnverified
+	}
+	user, err := ctl.users.GetByEmail(ctx, identity.Email)
+	if errors.Is(err, repository.ErrNotFound) {
+		user, err = ctl.createOIDCUser(ctx, identity)
+		if err != nil {
+			return m.User{}, err
+		}
+	} else if err != nil {
+		return m.User{}, err
+	} else if !user.EmailVerified {
+		// Whoever registered the address without confirming it may not be
+		// its owner; linking would hand them the provider's account.
+		return m.User{}, errLocalEmailUnverified
+	}
+
+	err = ctl.identities.Create(ctx, &m.UserIdentity{
+		UserID:    user.ID,
+		Issuer:    identity.Issuer,
+		Subject:   identity.Subject,
+		Email:     identity.Email,
+		CreatedAt: m.NewMySQLTime(time.Now()),
+	})
+	if errors.Is(err, repository.ErrDuplicate) {
+		// A concurrent callback linked the identity first.
+		return user, nil
+	} else if err != nil {
+		return m.User{}, err
+	}
+	slog.Info("Linked OIDC identity", "user_id", user.ID, "issuer", identity.Issuer)
+	return user, nil
+}
+
+// createOIDCUser registers the user of a new identity. The random password
+// is never shown; a password reset sets a usable one.
+func (ctl *Controller) createOIDCUser(ctx context.Context, identity *oidc.Identity) (m.User, error) {
+	password, err := h.RandomToken(32)
+	if err != nil {
+		return m.User{}, err
+	}
+	hashedPassword, err := h.HashPassword(password)
+	if err != nil {
+		return m.User{}, err
+	}
+	name := identity.Name
+	if name == "" {
+		name, _, _ = strings.Cut(identity.Email, "@")
+	}
+	if utf8.RuneCountInString(name) > maxNameLength {
+		name = string([]rune(name)[:maxNameLength])
+	}
+
+	createdAt := m.NewMySQLTime(time.Now())
+	user := m.User{
+		Email:         identity.Email,
+		Name:          name,
+		Password:      hashedPassword,
+		RoleId:        m.RoleUser,
+		EmailVerified: true,
+		CreatedAt:     createdAt,
+		UpdatedAt:     createdAt,
+	}
+	if err := ctl.users.Create(ctx, &user); err != nil {
+		return m.User{}, err
+	}
+	return user, nil
+}
+
+// oidcCookie returns the login state cookie; maxAge -1 deletes it. Lax
+// lets it ride along the top-level redirect back from the provider.
+func (ctl *Controller) oidcCookie(value string, maxAge int) *http.Cookie {
+	return &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    value,
+		Path:     "/user/oidc",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(ctl.opts.BaseURL, "https://"),
+		SameSite: http.SameSiteLaxMode,
+	}
+}
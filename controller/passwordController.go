@@ -0,0 +1,244 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	h "final-project/helper"
+	"final-project/mailer"
+	m "final-project/model"
+	"final-project/repository"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// @Summary Forgot password
+// @Description Email a one-time password reset token, as a link to PASSWORD_RESET_URL when it is set. The token is redeemed with POST /user/password/reset. The response is the same whether or not the address is registered.
+// @Param request body m.ForgotPasswordRequest true "Email address"
+// @Success 200 {object} map[string]string "Password reset email sent"
+// @Failure 400 {object} map[string]string "Invalid request body"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Router /user/password/forgot [post]
+func (ctl *Controller) ForgotPassword(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	var request m.ForgotPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	user, err := ctl.users.GetByEmail(r.Context(), request.Email)
+	if err != nil && !errors.Is(err, repository.ErrNotFound) {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err == nil {
+		// Mail in the background so a registered address does not answer
+		// measurably slower than an unknown one.
+		ctl.background.Add(1)
+		go func() {
+			defer ctl.background.Done()
+			ctl.sendPasswordReset(context.WithoutCancel(r.Context()), user)
+		}()
+	}
+
+	response := map[string]string{
+		"message": "If the address is registered, a password reset email has been sent",
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// @Summary Reset password
+// @Description Set a new password with the token from the password reset email. Every session of the user is signed out.
+// @Param request body m.ResetPasswordRequest true "Reset token and new password"
+// @Success 200 {object} map[string]string "Password has been reset"
+// @Failure 400 {object} map[string]string "Invalid or expired reset token"
+// @Failure 400 {object} map[string]string "Password should be at least 8 characters" (when the new password does not satisfy the password policy)
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Router /user/password/reset [post]
+func (ctl *Controller) ResetPassword(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	var request m.ResetPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	// A rejected password must leave the token usable for another try.
+	if err := h.ValidatePassword(request.Password); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	hashedPassword, err := h.HashPassword(request.Password)
+	if err != nil {
+		http.Error(w, "Failed to hash password", http.StatusInternalServerError)
+		return
+	}
+
+	reset, err := ctl.passwordResets.GetByHash(r.Context(), h.HashToken(request.Token))
+	if errors.Is(err, repository.ErrNotFound) || (err == nil && (reset.Used || time.Now().After(reset.ExpiresAt.Time))) {
+		http.Error(w, "Invalid or expired reset token", http.StatusBadRequest)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	user, err := ctl.users.GetByID(r.Context(), reset.UserID)
+	if errors.Is(err, repository.ErrNotFound) {
+		http.Error(w, "Invalid or expired reset token", http.StatusBadRequest)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// Redeem fails when a concurrent request got here with the same token
+	// first. It also spends the user's other reset links.
+	err = ctl.passwordResets.Redeem(r.Context(), reset.ID, hashedPassword, m.NewMySQLTime(time.Now()))
+	if errors.Is(err, repository.ErrNotFound) {
+		http.Error(w, "Invalid or expired reset token", http.StatusBadRequest)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Whoever knew the old password is locked out.
+	if err := ctl.signOutEverywhere(r.Context(), user.ID); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// The link reached the inbox, which is all verification proves.
+	if !user.EmailVerified {
+		if err := ctl.users.MarkEmailVerified(r.Context(), user.ID); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	response := map[string]string{
+		"message": "Password has been reset",
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// @Summary Change password
+// @Description Change the password of the authenticated user. Every other session is signed out and this client gets a new token pair.
+// @Security ApiKeyAuth
+// @Param request body m.ChangePasswordRequest true "Current and new password"
+// @Success 200 {object} map[string]interface{} "Password changed"
+// @Failure 400 {object} map[string]string "Invalid request body"
+// @Failure 400 {object} map[string]string "Password should be at least 8 characters" (when the new password does not satisfy the password policy)
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 403 {object} map[string]string "Current password is incorrect"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Router /user/password [post]
+func (ctl *Controller) ChangePassword(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	var request m.ChangePasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	user := principal(r).User
+	if bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(request.CurrentPassword)) != nil {
+		http.Error(w, "Current password is incorrect", http.StatusForbidden)
+		return
+	}
+	if err := h.ValidatePassword(request.NewPassword); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if request.NewPassword == request.CurrentPassword {
+		http.Error(w, "New password must differ from the current one", http.StatusBadRequest)
+		return
+	}
+
+	hashedPassword, err := h.HashPassword(request.NewPassword)
+	if err != nil {
+		http.Error(w, "Failed to hash password", http.StatusInternalServerError)
+		return
+	}
+	if err := ctl.users.UpdatePassword(r.Context(), user.ID, hashedPassword, m.NewMySQLTime(time.Now())); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := ctl.passwordResets.UseAll(r.Context(), user.ID); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// A new password logs out every other token; hand this client a fresh pair.
+	token, refreshToken, err := ctl.reissueTokens(r.Context(), r, user.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	response := map[string]interface{}{
+		"message":       "Password changed",
+		"access_token":  token,
+		"refresh_token": refreshToken,
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// sendPasswordReset stores a new reset token for user and mails it. It runs
+// after the response is written, so failures are only logged.
+func (ctl *Controller) sendPasswordReset(ctx context.Context, user m.User) {
+	token, err := h.RandomToken(32)
+	if err != nil {
+		slog.Error("Failed to create password reset token", "user_id", user.ID, "error", err)
+		return
+	}
+	err = ctl.passwordResets.Create(ctx, &m.PasswordReset{
+		UserID:    user.ID,
+		TokenHash: h.HashToken(token),
+		ExpiresAt: m.NewMySQLTime(h.PasswordResetExpiry()),
+		CreatedAt: m.NewMySQLTime(time.Now()),
+	})
+	if err != nil {
+		slog.Error("Failed to store password reset token", "user_id", user.ID, "error", err)
+		return
+	}
+
+	// The API only accepts the token in a POST, so a link must lead to a
+	// page that sends it.
+	var instructions string
+	if ctl.opts.PasswordResetURL != "" {
+		link, err := url.Parse(ctl.opts.PasswordResetURL)
+		if err != nil {
+			slog.Error("Invalid password reset URL", "error", err)
+			return
+		}
+		query := link.Query()
+		query.Set("token", token)
+		link.RawQuery = query.Encode()
+		instructions = "Use this link to choose a new one:\n\n" + link.String() + "\n\n" +
+			"The page sends the token with your new password to the API. The link works once."
+	} else {
+		instructions = "To choose a new one, send this token with your new password in a POST request to " +
+			ctl.opts.BaseURL + "/user/password/reset, as {\"token\": \"...\", \"password\": \"...\"}:\n\n" + token + "\n\n" +
+			"The token works once."
+	}
+	err = ctl.opts.Mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: "Hi " + user.Name + ",\n\n" +
+			"Someone asked to reset the password of your account. " + instructions + " " +
+			"If you did not ask for it, you can ignore this email.\n",
+	})
+	if err != nil {
+		slog.Error("Failed to send password reset email", "user_id", user.ID, "error", err)
+		return
+	}
+	slog.Info("Sent password reset email", "user_id", user.ID)
+}
@@ -0,0 +1,197 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	m "final-project/model"
+	"final-project/repository"
+	"net/http"
+	"strconv"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// @Summary Get all permissions
+// @Description Get the catalog of permissions that can be granted to roles
+// @Security ApiKeyAuth
+// @Success 200 {object} []m.Permission "List of permissions"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 403 {object} map[string]string "Access denied"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Router /permissions [get]
+func (ctl *Controller) GetPermissions(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	permissions, err := ctl.permissions.List(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(permissions)
+}
+
+// @Summary Get role permissions
+// @Description Get the permissions granted to a role
+// @Param id path int true "Role ID"
+// @Security ApiKeyAuth
+// @Success 200 {object} []m.Permission "List of permissions"
+// @Failure 400 {object} map[string]string "Invalid role ID"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 403 {object} map[string]string "Access denied"
+// @Failure 404 {object} map[string]string "Role not found"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Router /role/{id}/permissions [get]
+func (ctl *Controller) GetRolePermissions(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	role, ok := ctl.roleFromPath(w, r, ps)
+	if !ok {
+		return
+	}
+	permissions, err := ctl.permissions.ListByRole(r.Context(), role.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(permissions)
+}
+
+// @Summary Grant permission
+// @Description Grant a permission to a role
+// @Param id path int true "Role ID"
+// @Param permission body m.RolePermissionRequest true "Permission name to grant"
+// @Security ApiKeyAuth
+// @Success 200 {object} map[string]interface{} "Permission granted"
+// @Failure 400 {object} map[string]string "Invalid request body"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 403 {object} map[string]string "Access denied"
+// @Failure 404 {object} map[string]string "Role not found / Permission not found"
+// @Failure 409 {object} map[string]string "Permission already granted"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Router /role/{id}/permissions [post]
+func (ctl *Controller) GrantPermission(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	var request m.RolePermissionRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	role, ok := ctl.roleFromPath(w, r, ps)
+	if !ok {
+		return
+	}
+	permission, err := ctl.permissions.GetByName(r.Context(), request.Permission)
+	if errors.Is(err, repository.ErrNotFound) {
+		http.Error(w, "Permission not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	err = ctl.permissions.Grant(r.Context(), role.ID, permission.ID)
+	if errors.Is(err, repository.ErrDuplicate) {
+		http.Error(w, "Permission already granted", http.StatusConflict)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	response := map[string]interface{}{
+		"message":    "Permission granted",
+		"role":       role,
+		"permission": permission,
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// @Summary Revoke permission
+// @Description Revoke a permission from a role. roles:manage and users:manage cannot be revoked from the only role whose users have them.
+// @Param id path int true "Role ID"
+// @Param permission path string true "Permission name to revoke"
+// @Security ApiKeyAuth
+// @Success 200 {object} map[string]string "Permission revoked"
+// @Failure 400 {object} map[string]string "Invalid role ID"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 403 {object} map[string]string "Access denied"
+// @Failure 404 {object} map[string]string "Role not found / Permission not granted"
+// @Failure 409 {object} map[string]string "No other user has this permission"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Router /role/{id}/permissions/{permission} [delete]
+func (ctl *Controller) RevokePermission(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	role, ok := ctl.roleFromPath(w, r, ps)
+	if !ok {
+		return
+	}
+	name := ps.ByName("permission")
+	// Without a user left to manage roles nobody could grant permissions
+	// back, and without one to manage users nobody could change roles.
+	if name == m.PermManageRoles || name == m.PermManageUsers {
+		last, err := ctl.isLastRoleWith(r.Context(), role.ID, name)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if last {
+			http.Error(w, "No other user has this permission", http.StatusConflict)
+			return
+		}
+	}
+
+	permission, err := ctl.permissions.GetByName(r.Context(), name)
+	if err == nil {
+		err = ctl.permissions.Revoke(r.Context(), role.ID, permission.ID)
+	}
+	if errors.Is(err, repository.ErrNotFound) {
+		http.Error(w, "Permission not granted", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	response := map[string]string{
+		"message": "Permission revoked",
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// isLastRoleWith reports whether every user with the permission name holds
+// roleID, so revoking it from the role would leave nobody with it.
+func (ctl *Controller) isLastRoleWith(ctx context.Context, roleID int, name string) (bool, error) {
+	granted, err := ctl.permissions.HasPermission(ctx, roleID, name)
+	if err != nil || !granted {
+		return false, err
+	}
+	withPermission, err := ctl.users.CountWithPermission(ctx, name)
+	if err != nil || withPermission == 0 {
+		return false, err
+	}
+	holders, err := ctl.users.CountByRole(ctx, roleID)
+	if err != nil {
+		return false, err
+	}
+	return holders >= withPermission, nil
+}
+
+// roleFromPath loads the role named by the :id parameter, writing the error
+// response itself when it cannot.
+func (ctl *Controller) roleFromPath(w http.ResponseWriter, r *http.Request, ps httprouter.Params) (m.Role, bool) {
+	roleID, err := strconv.Atoi(ps.ByName("id"))
+	if err != nil {
+		http.Error(w, "Invalid role ID", http.StatusBadRequest)
+		return m.Role{}, false
+	}
+	role, err := ctl.roles.GetByID(r.Context(), roleID)
+	if errors.Is(err, repository.ErrNotFound) {
+		http.Error(w, "Role not found", http.StatusNotFound)
+		return m.Role{}, false
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return m.Role{}, false
+	}
+	return role, true
+}
@@ -0,0 +1,170 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	m "final-project/model"
+	"final-project/repository"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// @Summary Update own profile
+// @Description Update only the given fields of the authenticated user's profile: name, avatar_url, bio and preferences (theme, language, timezone)
+// @Security ApiKeyAuth
+// @Param profile body m.UserProfilePatch true "Fields to change"
+// @Success 200 {object} map[string]interface{} "Profile updated" (with the user as m.SelfUser)
+// @Failure 400 {object} map[string]string "Invalid request body" (when the body has unknown fields or a field is invalid)
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Router /user/me [patch]
+func (ctl *Controller) PatchProfile(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	ctl.patchProfile(w, r, principal(r).User, func(user m.User) interface{} { return m.NewSelfUser(user) })
+}
+
+// @Summary Update user profile
+// @Description Update only the given profile fields of any user (requires users:manage)
+// @Security ApiKeyAuth
+// @Param id path int true "User ID"
+// @Param profile body m.UserProfilePatch true "Fields to change"
+// @Success 200 {object} map[string]interface{} "Profile updated" (with the user as m.AdminUser)
+// @Failure 400 {object} map[string]string "Invalid userID / Invalid request body"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 403 {object} map[string]string "Access denied"
+// @Failure 404 {object} map[string]string "User not found"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Router /user/detail/{id} [patch]
+func (ctl *Controller) PatchUserProfile(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	userID, err := strconv.Atoi(ps.ByName("id"))
+	if err != nil {
+		http.Error(w, "Invalid userID", http.StatusBadRequest)
+		return
+	}
+	user, err := ctl.users.GetByID(r.Context(), userID)
+	if errors.Is(err, repository.ErrNotFound) {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	active, err := ctl.hasSession(r.Context(), user.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	ctl.patchProfile(w, r, user, func(user m.User) interface{} { return m.NewAdminUser(user, active) })
+}
+
+// patchProfile applies the body to user and answers with the updated user
+// in the representation view returns.
+func (ctl *Controller) patchProfile(w http.ResponseWriter, r *http.Request, user m.User, view func(m.User) interface{}) {
+	var patch m.UserProfilePatch
+	decoder := json.NewDecoder(r.Body)
+	// Reject fields such as password or email instead of silently ignoring them.
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&patch); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	if err := applyProfilePatch(&user, patch); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	user.UpdatedAt = m.NewMySQLTime(time.Now())
+	err := ctl.users.UpdateProfile(r.Context(), user)
+	if errors.Is(err, repository.ErrNotFound) {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	response := map[string]interface{}{
+		"message": "Profile updated",
+		"user":    view(user),
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// Profile limits, matching the users table columns.
+const (
+	maxNameLength      = 255
+	maxAvatarURLLength = 500
+	maxBioLength       = 1000
+)
+
+var languageTag = regexp.MustCompile(`^[a-zA-Z]{2,3}(-[a-zA-Z0-9]{2,8})*$`)
+
+// applyProfilePatch validates every field present in patch and copies it
+// onto user. Nothing is applied if any field is invalid.
+func applyProfilePatch(user *m.User, patch m.UserProfilePatch) error {
+	updated := *user
+	if patch.Name != nil {
+		name := strings.TrimSpace(*patch.Name)
+		if name == "" {
+			return errors.New("Name must not be empty")
+		}
+		if utf8.RuneCountInString(name) > maxNameLength {
+			return errors.New("Name should be at most 255 characters")
+		}
+		updated.Name = name
+	}
+	if patch.AvatarURL != nil {
+		avatar := strings.TrimSpace(*patch.AvatarURL)
+		if avatar != "" {
+			u, err := url.Parse(avatar)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return errors.New("Avatar URL must be an http or https URL")
+			}
+			if len(avatar) > maxAvatarURLLength {
+				return errors.New("Avatar URL should be at most 500 characters")
+			}
+		}
+		updated.AvatarURL = avatar
+	}
+	if patch.Bio != nil {
+		bio := strings.TrimSpace(*patch.Bio)
+		if utf8.RuneCountInString(bio) > maxBioLength {
+			return errors.New("Bio should be at most 1000 characters")
+		}
+		updated.Bio = bio
+	}
+	if prefs := patch.Preferences; prefs != nil {
+		if prefs.Theme != nil {
+			switch *prefs.Theme {
+			case "", "light", "dark", "system":
+			default:
+				return errors.New("Theme must be light, dark or system")
+			}
+			updated.Preferences.Theme = *prefs.Theme
+		}
+		if prefs.Language != nil {
+			if *prefs.Language != "" && !languageTag.MatchString(*prefs.Language) {
+				return errors.New("Language must be a language tag such as en or id-ID")
+			}
+			updated.Preferences.Language = *prefs.Language
+		}
+		if prefs.Timezone != nil {
+			if *prefs.Timezone != "" {
+				if _, err := time.LoadLocation(*prefs.Timezone); err != nil || *prefs.Timezone == "Local" {
+					return errors.New("Timezone must be an IANA time zone such as Asia/Jakarta")
+				}
+			}
+			updated.Preferences.Timezone = *prefs.Timezone
+		}
+	}
+	*user = updated
+	return nil
+}
@@ -1,11 +1,10 @@
 package controller
 
 import (
-	"database/sql"
 	"encoding/json"
-	d "final-project/db"
-	h "final-project/helper"
+	"errors"
 	m "final-project/model"
+	"final-project/repository"
 	"net/http"
 	"strconv"
 	"time"
@@ -27,7 +26,7 @@ import (
 // @Failure 400 {object} map[string]string "Rating should be 0-10" (when the review rating is greater than 10)
 // @Failure 500 {object} map[string]string "Internal server error" (when there is a problem with the database)
 // @Router /review [post]
-func AddReview(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+func (ctl *Controller) AddReview(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 	var review m.Review
 	if err := json.NewDecoder(r.Body).Decode(&review); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
@@ -36,19 +35,10 @@ func AddReview(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 	defer r.Body.Close()
 
 	// Authenticate and extract UserID from JWT
-	claims, err := h.Authenticate(r)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusUnauthorized)
-		return
-	}
-	userIDFloat, ok := claims["id"].(float64)
-	if !ok {
-		http.Error(w, "Invalid token claims", http.StatusUnauthorized)
-		return
-	}
+	caller := principal(r)
 
-	userID := int(userIDFloat)
-	gameExists, err := h.IsGameExists(review.GameID)
+	userID := caller.User.ID
+	gameExists, err := ctl.games.Exists(r.Context(), review.GameID)
 	if err != nil {
 		http.Error(w, "Failed to check game existence", http.StatusInternalServerError)
 		return
@@ -58,14 +48,13 @@ func AddReview(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 		http.Error(w, "Nothing found with given id", http.StatusBadRequest)
 		return
 	}
-	var count int
-	err = d.Db.QueryRow("SELECT COUNT(*) FROM reviews WHERE user_id = ? AND game_id = ?", userID, review.GameID).Scan(&count)
+	reviewed, err := ctl.reviews.Exists(r.Context(), userID, review.GameID)
 	if err != nil {
 		http.Error(w, "Not found", http.StatusInternalServerError)
 		return
 	}
 
-	if count > 0 {
+	if reviewed {
 		http.Error(w, "You can only make one review per game", http.StatusConflict)
 		return
 	}
@@ -81,23 +70,14 @@ func AddReview(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 
 	createdAt := m.NewMySQLTime(time.Now())
 	review.UserID = userID
-	result, err := d.Db.Exec("INSERT INTO reviews (user_id, game_id, description, rating, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?)",
-		review.UserID, review.GameID, review.Description, review.Rating, createdAt, createdAt)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-
-	reviewID, err := result.LastInsertId()
+	review.CreatedAt = createdAt
+	review.UpdatedAt = createdAt
+	err = ctl.reviews.Create(r.Context(), &review)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	review.ID = int(reviewID)
-	review.CreatedAt = createdAt
-	review.UpdatedAt = createdAt
-
 	response := map[string]interface{}{
 		"message": "Review added",
 		"review":  review,
@@ -119,8 +99,13 @@ func AddReview(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 // @Failure 400 {object} map[string]string "Write something, please" (when the updated review description is empty)
 // @Failure 400 {object} map[string]string "Rating should be 0-10" (when the updated review rating is greater than 10)
 // @Failure 500 {object} map[string]string "Internal server error" (when there is a problem with the database)
-// @Router /review [post]
-func UpdateReview(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+// @Router /review/{id} [post]
+func (ctl *Controller) UpdateReview(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	reviewID, err := strconv.Atoi(ps.ByName("id"))
+	if err != nil {
+		http.Error(w, "Invalid id", http.StatusBadRequest)
+		return
+	}
 	var review m.Review
 	if err := json.NewDecoder(r.Body).Decode(&review); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
@@ -129,15 +114,11 @@ func UpdateReview(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 	defer r.Body.Close()
 
 	// Authenticate and extract UserID from JWT
-	claims, err := h.Authenticate(r)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusUnauthorized)
-		return
-	}
-	var existingReview m.Review
-	err = d.Db.QueryRow("SELECT id, user_id, game_id, created_at, updated_at FROM reviews WHERE user_id = ?", review.ID).
-		Scan(&existingReview.ID, &existingReview.UserID, &existingReview.GameID, &existingReview.CreatedAt, &existingReview.UpdatedAt)
-	if err == sql.ErrNoRows {
+	caller := principal(r)
+
+	userID := caller.User.ID
+	existingReview, err := ctl.reviews.GetByID(r.Context(), reviewID)
+	if errors.Is(err, repository.ErrNotFound) || (err == nil && existingReview.UserID != userID) {
 		http.Error(w, "Review not found", http.StatusNotFound)
 		return
 	} else if err != nil {
@@ -145,14 +126,6 @@ func UpdateReview(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 		return
 	}
 
-	userIDFloat, ok := claims["id"].(float64)
-	if !ok {
-		http.Error(w, "Invalid token claims", http.StatusUnauthorized)
-		return
-	}
-
-	userID := int(userIDFloat)
-
 	if review.Description == "" {
 		http.Error(w, "Write something, please", http.StatusBadRequest)
 		return
@@ -163,18 +136,19 @@ func UpdateReview(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 	}
 
 	createdAt := m.NewMySQLTime(time.Now())
-	review.UserID = userID
 
-	_, err = d.Db.Exec("UPDATE reviews SET rating = ?, description = ?, updated_at = ? WHERE id = ?",
-		review.Rating, review.Description, createdAt, review.UserID)
+	// Update review fields
+	review.ID = existingReview.ID
+	review.UserID = userID
+	review.GameID = existingReview.GameID
+	review.CreatedAt = existingReview.CreatedAt
+	review.UpdatedAt = createdAt
+	err = ctl.reviews.Update(r.Context(), review)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	// Update review fields
-	review.UpdatedAt = createdAt
-
 	response := map[string]interface{}{
 		"message": "Review updated",
 		"review":  review,
@@ -193,37 +167,19 @@ func UpdateReview(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 // @Failure 401 {object} map[string]string "Unauthorized" (when the JWT token is missing or invalid)
 // @Failure 500 {object} map[string]string "Internal server error" (when there is a problem with the database)
 // @Router /review [get]
-func GetReview(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
-	claims, err := h.Authenticate(r)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusUnauthorized)
-	}
-	_, ok := claims["id"].(float64)
-	if !ok {
-		http.Error(w, "Invalid token claims", http.StatusUnauthorized)
-		return
-	}
-	rows, err := d.Db.Query("SELECT id, user_id, game_id, rating, description, created_at, updated_at from reviews")
+func (ctl *Controller) GetReview(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	reviews, err := ctl.reviews.List(r.Context())
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	defer rows.Close()
-	var reviews []m.Review
-	for rows.Next() {
-		var review m.Review
-		if err := rows.Scan(&review.ID, &review.UserID, &review.GameID, &review.Rating, &review.Description, &review.CreatedAt, &review.UpdatedAt); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
-		reviews = append(reviews, review)
-	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(reviews)
 }
 
 // DeleteReview handles the HTTP request to delete a review by its ID.
-// Only authenticated users can delete their own reviews.
+// Users can delete their own reviews; roles with the reviews:moderate
+// permission can delete any review.
 // @Summary Delete review by ID
 // @Description Delete a review by its ID
 // @Param id path int true "Review ID to delete"
@@ -231,31 +187,38 @@ func GetReview(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 // @Success 200 {object} map[string]string "Review successfully deleted"
 // @Failure 400 {object} map[string]string "Invalid review ID" (when the review ID in the URL path is not a valid integer)
 // @Failure 401 {object} map[string]string "Unauthorized" (when the JWT token is missing or invalid)
-// @Failure 404 {object} map[string]string "Review not found" (when the specified review ID does not exist in the database)
+// @Failure 404 {object} map[string]string "Review not found" (when the specified review ID does not exist or belongs to another user)
 // @Failure 500 {object} map[string]string "Internal server error" (when there is a problem with the database)
 // @Router /review/{id} [delete]
-func DeleteReview(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
-	userID, err := strconv.Atoi(ps.ByName("uid"))
+func (ctl *Controller) DeleteReview(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	reviewID, err := strconv.Atoi(ps.ByName("id"))
 	if err != nil {
 		http.Error(w, "Invalid id", http.StatusBadRequest)
 		return
 	}
-	_, err = h.Authenticate(r)
-	if err != nil {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
-		return
-	}
-	var existingReview m.Review
-	err = d.Db.QueryRow("SELECT id, user_id, game_id, rating, description, created_at, updated_at from reviews WHERE user_id = ?", userID).
-		Scan(&existingReview.ID, &existingReview.UserID, &existingReview.GameID, &existingReview.Rating, &existingReview.Description, &existingReview.CreatedAt, &existingReview.UpdatedAt)
-	if err == sql.ErrNoRows {
+	caller := principal(r)
+
+	review, err := ctl.reviews.GetByID(r.Context(), reviewID)
+	if errors.Is(err, repository.ErrNotFound) {
 		http.Error(w, "Review not found", http.StatusNotFound)
 		return
 	} else if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	_, err = d.Db.Exec("DELETE from reviews where id = ?", existingReview.ID)
+	if review.UserID != caller.User.ID {
+		moderator, err := ctl.opts.Authorizer.Allows(r.Context(), caller, m.PermModerateReviews)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !moderator {
+			http.Error(w, "Review not found", http.StatusNotFound)
+			return
+		}
+	}
+
+	err = ctl.reviews.Delete(r.Context(), review.ID)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -1,11 +1,10 @@
 package controller
 
 import (
-	"database/sql"
 	"encoding/json"
-	d "final-project/db"
-	h "final-project/helper"
+	"errors"
 	m "final-project/model"
+	"final-project/repository"
 	"net/http"
 	"strconv"
 	"time"
@@ -24,55 +23,29 @@ import (
 // @Failure 409 {object} map[string]string "Role already exists"
 // @Failure 500 {object} map[string]string "Internal server error"
 // @Router /role [post]
-func CreateRole(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+func (ctl *Controller) CreateRole(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 	var role m.Role
 	if err := json.NewDecoder(r.Body).Decode(&role); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 	defer r.Body.Close()
-	claims, err := h.Authenticate(r)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusUnauthorized)
-		return
-	}
-
-	// Check if the role claim exists and is equal to 2 (admin role)
-	if role, ok := claims["role"].(float64); !ok || role != 2 {
-		http.Error(w, "Access denied", http.StatusForbidden)
-		return
-	}
-	var count int
-	err = d.Db.QueryRow("SELECT COUNT(*) FROM roles WHERE role_name = ?", role.RoleName).Scan(&count)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-
-	if count > 0 {
-		http.Error(w, "Role already exist", http.StatusConflict)
-		return
-	}
 	if role.RoleName == "" {
 		http.Error(w, "Role Name should be filled!", http.StatusBadRequest)
 		return
 	}
 	createdAt := m.NewMySQLTime(time.Now())
-	result, err := d.Db.Exec("INSERT INTO roles (role_name, created_at, updated_at) VALUES (?, ?, ?)",
-		role.RoleName, createdAt, createdAt)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	role.ID = 0
+	role.CreatedAt = createdAt
+	role.UpdatedAt = createdAt
+	err := ctl.roles.Create(r.Context(), &role)
+	if errors.Is(err, repository.ErrDuplicate) {
+		http.Error(w, "Role already exist", http.StatusConflict)
 		return
-	}
-
-	roleID, err := result.LastInsertId()
-	if err != nil {
+	} else if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	role.ID = int(roleID)
-	role.CreatedAt = createdAt
-	role.UpdatedAt = createdAt
 	response := map[string]interface{}{
 		"message": "Role creared",
 		"role":    role,
@@ -88,40 +61,18 @@ func CreateRole(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 // @Failure 401 {object} map[string]string "Unauthorized"
 // @Failure 500 {object} map[string]string "Internal server error"
 // @Router /role [get]
-func GetRole(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
-	claims, err := h.Authenticate(r)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusUnauthorized)
-		return
-	}
-	// Check if the role claim exists and is equal to 2 (admin role)
-	if role, ok := claims["role"].(float64); !ok || role != 2 {
-		http.Error(w, "Access denied", http.StatusForbidden)
-		return
-	}
-
-	rows, err := d.Db.Query("SELECT id, role_name FROM roles")
+func (ctl *Controller) GetRole(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	roles, err := ctl.roles.List(r.Context())
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	defer rows.Close()
-
-	var roles []m.Role
-	for rows.Next() {
-		var role m.Role
-		if err := rows.Scan(&role.ID, &role.RoleName); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
-		roles = append(roles, role)
-	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(roles)
 }
 
 // @Summary Delete role by ID
-// @Description Delete a role by its ID
+// @Description Delete a role by its ID. The built-in user and admin roles and roles that users still hold cannot be deleted.
 // @Param id path int true "Role ID to delete"
 // @Security ApiKeyAuth
 // @Success 200 {object} map[string]string "Role successfully deleted"
@@ -129,46 +80,99 @@ func GetRole(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 // @Failure 401 {object} map[string]string "Unauthorized"
 // @Failure 403 {object} map[string]string "Access denied"
 // @Failure 404 {object} map[string]string "Role not found"
+// @Failure 409 {object} map[string]string "Built-in roles cannot be deleted / Role is still assigned to users"
 // @Failure 500 {object} map[string]string "Internal server error"
 // @Router /role/{id} [delete]
-func DeleteRole(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
-
-	claims, err := h.Authenticate(r)
+func (ctl *Controller) DeleteRole(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	roleID, err := strconv.Atoi(ps.ByName("id"))
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusUnauthorized)
+		http.Error(w, "Invalid role ID", http.StatusBadRequest)
 		return
 	}
-	// Check if the role claim exists and is equal to 2 (admin role)
-	if role, ok := claims["role"].(float64); !ok || role != 2 {
-		http.Error(w, "Access denied", http.StatusForbidden)
+	if roleID == m.RoleUser || roleID == m.RoleAdmin {
+		http.Error(w, "Built-in roles cannot be deleted", http.StatusConflict)
 		return
 	}
-	roleID, err := strconv.Atoi(ps.ByName("id"))
+	holders, err := ctl.users.CountByRole(r.Context(), roleID)
 	if err != nil {
-		http.Error(w, "Invalid userID", http.StatusBadRequest)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if holders > 0 {
+		http.Error(w, "Role is still assigned to users", http.StatusConflict)
 		return
 	}
 
-	var existingRole m.Role
-	err = d.Db.QueryRow("SELECT id, role_name, created_at, updated_at FROM roles WHERE id = ?", roleID).
-		Scan(&existingRole.ID, &existingRole.RoleName, &existingRole.CreatedAt, &existingRole.UpdatedAt)
-	if err == sql.ErrNoRows {
-		http.Error(w, "User not found", http.StatusNotFound)
+	err = ctl.roles.Delete(r.Context(), roleID)
+	if errors.Is(err, repository.ErrNotFound) {
+		http.Error(w, "Role not found", http.StatusNotFound)
 		return
 	} else if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	response := map[string]string{
+		"message": "Role successfully deleted",
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
 
-	_, err = d.Db.Exec("DELETE FROM roles WHERE id = ?", roleID)
+// @Summary Update role
+// @Description Rename a role
+// @Param id path int true "Role ID to update"
+// @Param role body m.Role true "Role object with the new role name"
+// @Security ApiKeyAuth
+// @Success 200 {object} map[string]interface{} "Role updated"
+// @Failure 400 {object} map[string]string "Invalid role ID"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 403 {object} map[string]string "Access denied"
+// @Failure 404 {object} map[string]string "Role not found"
+// @Failure 409 {object} map[string]string "Role already exists"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Router /role/{id} [put]
+func (ctl *Controller) UpdateRole(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	roleID, err := strconv.Atoi(ps.ByName("id"))
 	if err != nil {
+		http.Error(w, "Invalid role ID", http.StatusBadRequest)
+		return
+	}
+	var role m.Role
+	if err := json.NewDecoder(r.Body).Decode(&role); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+	if role.RoleName == "" {
+		http.Error(w, "Role Name should be filled!", http.StatusBadRequest)
+		return
+	}
+
+	existingRole, err := ctl.roles.GetByID(r.Context(), roleID)
+	if errors.Is(err, repository.ErrNotFound) {
+		http.Error(w, "Role not found", http.StatusNotFound)
+		return
+	} else if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	response := map[string]string{
-		"message": "Role successfully deleted",
+
+	existingRole.RoleName = role.RoleName
+	existingRole.UpdatedAt = m.NewMySQLTime(time.Now())
+	err = ctl.roles.Update(r.Context(), existingRole)
+	if errors.Is(err, repository.ErrDuplicate) {
+		http.Error(w, "Role already exist", http.StatusConflict)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
 	}
 
+	response := map[string]interface{}{
+		"message": "Role updated",
+		"role":    existingRole,
+	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
 }
@@ -0,0 +1,125 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"final-project/repository"
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// @Summary List sessions
+// @Description List the signed-in sessions of the authenticated user, most recently used first
+// @Security ApiKeyAuth
+// @Success 200 {object} []m.Session "List of sessions"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Router /sessions [get]
+func (ctl *Controller) GetSessions(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	caller := principal(r)
+
+	sessions, err := ctl.sessions.ListByUser(r.Context(), caller.User.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == caller.Claims.SessionID
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(sessions)
+}
+
+// @Summary Revoke session
+// @Description Sign one of the authenticated user's sessions out
+// @Param id path string true "Session ID"
+// @Security ApiKeyAuth
+// @Success 200 {object} map[string]string "Session revoked"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 404 {object} map[string]string "Session not found"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Router /session/{id} [delete]
+func (ctl *Controller) RevokeSession(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	caller := principal(r)
+
+	session, err := ctl.sessions.GetByID(r.Context(), ps.ByName("id"))
+	if errors.Is(err, repository.ErrNotFound) || (err == nil && (session.UserID != caller.User.ID || session.Revoked)) {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := ctl.revokeSession(r.Context(), session.ID); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	response := map[string]string{
+		"message": "Session revoked",
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// @Summary Revoke other sessions
+// @Description Sign the authenticated user out of every session except the current one
+// @Security ApiKeyAuth
+// @Success 200 {object} map[string]string "Other sessions revoked"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Router /sessions [delete]
+func (ctl *Controller) RevokeOtherSessions(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	caller := principal(r)
+
+	sessions, err := ctl.sessions.ListByUser(r.Context(), caller.User.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	for _, session := range sessions {
+		if session.ID == caller.Claims.SessionID {
+			continue
+		}
+		if err := ctl.revokeSession(r.Context(), session.ID); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	response := map[string]string{
+		"message": "Other sessions revoked",
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// signOutEverywhere invalidates every access and refresh token of userID
+// and ends all of its sessions.
+func (ctl *Controller) signOutEverywhere(ctx context.Context, userID int) error {
+	if err := ctl.users.RevokeTokens(ctx, userID); err != nil {
+		return err
+	}
+	if err := ctl.sessions.RevokeOthers(ctx, userID, ""); err != nil {
+		return err
+	}
+	return ctl.refreshTokens.RevokeUser(ctx, userID)
+}
+
+// hasSession reports whether userID is signed in on any device.
+func (ctl *Controller) hasSession(ctx context.Context, userID int) (bool, error) {
+	sessions, err := ctl.sessions.ListByUser(ctx, userID)
+	return len(sessions) > 0, err
+}
+
+// revokeSession signs a session out and revokes its refresh tokens. An
+// already revoked session is not an error.
+func (ctl *Controller) revokeSession(ctx context.Context, sessionID string) error {
+	err := ctl.sessions.Revoke(ctx, sessionID)
+	if err != nil && !errors.Is(err, repository.ErrNotFound) {
+		return err
+	}
+	return ctl.refreshTokens.RevokeFamily(ctx, sessionID)
+}
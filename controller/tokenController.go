@@ -0,0 +1,173 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	h "final-project/helper"
+	m "final-project/model"
+	"final-project/repository"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// @Summary Refresh access token
+// @Description Exchange a refresh token for a new access token and a new refresh token. Each refresh token can be used once; presenting a used one revokes every token of that session.
+// @Param token body m.RefreshRequest true "Refresh token"
+// @Success 200 {object} map[string]interface{} "Token refreshed"
+// @Failure 400 {object} map[string]string "Invalid request body"
+// @Failure 401 {object} map[string]string "Invalid refresh token / Refresh token expired"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Router /user/token/refresh [post]
+func (ctl *Controller) RefreshToken(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	var request m.RefreshRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	stored, err := ctl.refreshTokens.GetByHash(r.Context(), h.HashToken(request.RefreshToken))
+	if errors.Is(err, repository.ErrNotFound) {
+		http.Error(w, "Invalid refresh token", http.StatusUnauthorized)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if time.Now().After(stored.ExpiresAt.Time) {
+		http.Error(w, "Refresh token expired", http.StatusUnauthorized)
+		return
+	}
+
+	session, err := ctl.sessions.GetByID(r.Context(), stored.FamilyID)
+	if errors.Is(err, repository.ErrNotFound) || (err == nil && session.Revoked) {
+		http.Error(w, "Invalid refresh token", http.StatusUnauthorized)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Revoke fails for a token that was already rotated, which means it
+	// leaked: end the whole session so neither holder can continue.
+	err = ctl.refreshTokens.Revoke(r.Context(), stored.ID)
+	if errors.Is(err, repository.ErrNotFound) {
+		slog.Warn("Refresh token reuse detected", "user_id", stored.UserID, "session_id", stored.FamilyID)
+		if err := ctl.revokeSession(r.Context(), stored.FamilyID); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		http.Error(w, "Invalid refresh token", http.StatusUnauthorized)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	user, err := ctl.users.GetByID(r.Context(), stored.UserID)
+	if errors.Is(err, repository.ErrNotFound) {
+		http.Error(w, "Invalid refresh token", http.StatusUnauthorized)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	accessToken, refreshToken, err := ctl.issueTokens(r.Context(), r, user, stored.FamilyID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	response := map[string]interface{}{
+		"message":       "Token refreshed",
+		"access_token":  accessToken,
+		"refresh_token": refreshToken,
+		"expires_in":    int(h.TokenTTL().Seconds()),
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// @Summary JSON Web Key Set
+// @Description Public keys that verify access tokens, identified by kid. Empty when tokens are HS256-signed.
+// @Success 200 {object} map[string]interface{} "JWKS"
+// @Router /.well-known/jwks.json [get]
+func (ctl *Controller) GetJWKS(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	response := map[string]interface{}{
+		"keys": h.JWKS(),
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	json.NewEncoder(w).Encode(response)
+}
+
+// issueTokens creates an access token for user and adds a refresh token
+// to sessionID. An empty sessionID starts a new session for the requesting
+// device. The access token is not stored; sessions and token_version
+// revoke it.
+func (ctl *Controller) issueTokens(ctx context.Context, r *http.Request, user m.User, sessionID string) (string, string, error) {
+	var err error
+	if sessionID == "" {
+		if sessionID, err = ctl.startSession(ctx, r, user.ID); err != nil {
+			return "", "", err
+		}
+	}
+	accessToken, err := h.CreateToken(user, sessionID)
+	if err != nil {
+		return "", "", err
+	}
+
+	refreshToken, err := h.RandomToken(32)
+	if err != nil {
+		return "", "", err
+	}
+	err = ctl.refreshTokens.Create(ctx, &m.RefreshToken{
+		UserID:    user.ID,
+		FamilyID:  sessionID,
+		TokenHash: h.HashToken(refreshToken),
+		Device:    truncate(r.UserAgent(), 255),
+		ExpiresAt: m.NewMySQLTime(h.RefreshTokenExpiry()),
+		CreatedAt: m.NewMySQLTime(time.Now()),
+	})
+	if err != nil {
+		return "", "", err
+	}
+	return accessToken, refreshToken, nil
+}
+
+// startSession records a new login of userID from the requesting device.
+// Clients may name the device with the X-Device-Name header.
+func (ctl *Controller) startSession(ctx context.Context, r *http.Request, userID int) (string, error) {
+	sessionID, err := h.RandomToken(16)
+	if err != nil {
+		return "", err
+	}
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+	now := m.NewMySQLTime(time.Now())
+	err = ctl.sessions.Create(ctx, &m.Session{
+		ID:         sessionID,
+		UserID:     userID,
+		Device:     truncate(r.Header.Get("X-Device-Name"), 255),
+		IPAddress:  truncate(ip, 64),
+		UserAgent:  truncate(r.UserAgent(), 255),
+		CreatedAt:  now,
+		LastSeenAt: now,
+	})
+	return sessionID, err
+}
+
+func truncate(s string, n int) string {
+	if len(s) > n {
+		return s[:n]
+	}
+	return s
+}
@@ -0,0 +1,406 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	h "final-project/helper"
+	m "final-project/model"
+	"final-project/repository"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	recoveryCodeCount = 10
+	// maxChallengeAttempts bounds the codes that can be guessed with one
+	// login challenge.
+	maxChallengeAttempts = 5
+	// maxUserAttempts bounds the codes that can be guessed for one user per
+	// userAttemptWindow, however many challenges the guesses are spread over.
+	maxUserAttempts   = 10
+	userAttemptWindow = 15 * time.Minute
+)
+
+// @Summary Two-factor status
+// @Description Show whether two-factor authentication is enabled for the authenticated user and how many recovery codes are left
+// @Security ApiKeyAuth
+// @Success 200 {object} map[string]interface{} "Two-factor status"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Router /user/2fa [get]
+func (ctl *Controller) GetTwoFactor(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	user := principal(r).User
+	remaining, err := ctl.recoveryCodes.CountUnused(r.Context(), user.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	response := map[string]interface{}{
+		"enabled":             user.TwoFactorEnabled,
+		"required":            ctl.twoFactorRequired(user),
+		"recovery_codes_left": remaining,
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// @Summary Start two-factor enrollment
+// @Description Create a new TOTP secret for the authenticated user. Add it to an authenticator app, then confirm with POST /user/2fa/enable.
+// @Security ApiKeyAuth
+// @Success 200 {object} map[string]string "TOTP secret and otpauth URI"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 409 {object} map[string]string "Two-factor authentication is already enabled"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Router /user/2fa/setup [post]
+func (ctl *Controller) SetupTwoFactor(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	user := principal(r).User
+	if user.TwoFactorEnabled {
+		http.Error(w, "Two-factor authentication is already enabled", http.StatusConflict)
+		return
+	}
+
+	secret, err := h.NewTOTPSecret()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	user.TOTPSecret = secret
+	if err := ctl.users.UpdateTwoFactor(r.Context(), user); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	response := map[string]string{
+		"message":     "Scan the URI with an authenticator app, then confirm a code",
+		"secret":      secret,
+		"otpauth_uri": h.TOTPURI(secret, user.Email),
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// @Summary Enable two-factor authentication
+// @Description Confirm the secret from POST /user/2fa/setup with a current code. The response lists the recovery codes, which are not shown again.
+// @Security ApiKeyAuth
+// @Param request body m.TwoFactorCodeRequest true "TOTP code"
+// @Success 200 {object} map[string]interface{} "Two-factor authentication enabled"
+// @Failure 400 {object} map[string]string "Invalid code / Start with POST /user/2fa/setup"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 409 {object} map[string]string "Two-factor authentication is already enabled"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Router /user/2fa/enable [post]
+func (ctl *Controller) EnableTwoFactor(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	var request m.TwoFactorCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	user := principal(r).User
+	if user.TwoFactorEnabled {
+		http.Error(w, "Two-factor authentication is already enabled", http.StatusConflict)
+		return
+	}
+	if user.TOTPSecret == "" {
+		http.Error(w, "Start with POST /user/2fa/setup", http.StatusBadRequest)
+		return
+	}
+	step, ok := h.ValidateTOTP(user.TOTPSecret, request.Code, time.Now())
+	if !ok {
+		http.Error(w, "Invalid code", http.StatusBadRequest)
+		return
+	}
+
+	user.TwoFactorEnabled = true
+	if err := ctl.users.UpdateTwoFactor(r.Context(), user); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := ctl.users.UseTOTPStep(r.Context(), user.ID, step); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	codes, err := ctl.replaceRecoveryCodes(r.Context(), user.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	slog.Info("Two-factor authentication enabled", "user_id", user.ID)
+
+	response := map[string]interface{}{
+		"message":        "Two-factor authentication enabled",
+		"recovery_codes": codes,
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// @Summary Disable two-factor authentication
+// @Description Turn two-factor authentication off. Needs the password and a TOTP or recovery code.
+// @Security ApiKeyAuth
+// @Param request body m.TwoFactorDisableRequest true "Password and code"
+// @Success 200 {object} map[string]string "Two-factor authentication disabled"
+// @Failure 400 {object} map[string]string "Invalid code / Two-factor authentication is not enabled"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 403 {object} map[string]string "Current password is incorrect / Two-factor authentication is required for your role"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Router /user/2fa/disable [post]
+func (ctl *Controller) DisableTwoFactor(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	var request m.TwoFactorDisableRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	user := principal(r).User
+	if !user.TwoFactorEnabled {
+		http.Error(w, "Two-factor authentication is not enabled", http.StatusBadRequest)
+		return
+	}
+	if ctl.twoFactorRequired(user) {
+		http.Error(w, "Two-factor authentication is required for your role", http.StatusForbidden)
+		return
+	}
+	if bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(request.Password)) != nil {
+		http.Error(w, "Current password is incorrect", http.StatusForbidden)
+		return
+	}
+	ok, err := ctl.verifySecondFactor(r.Context(), user, request.Code)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		http.Error(w, "Invalid code", http.StatusBadRequest)
+		return
+	}
+
+	user.TwoFactorEnabled = false
+	user.TOTPSecret = ""
+	if err := ctl.users.UpdateTwoFactor(r.Context(), user); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := ctl.recoveryCodes.Replace(r.Context(), user.ID, nil); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	slog.Info("Two-factor authentication disabled", "user_id", user.ID)
+
+	response := map[string]string{
+		"message": "Two-factor authentication disabled",
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// @Summary Regenerate recovery codes
+// @Description Replace the recovery codes of the authenticated user. Needs a TOTP or recovery code; the old codes stop working.
+// @Security ApiKeyAuth
+// @Param request body m.TwoFactorCodeRequest true "TOTP or recovery code"
+// @Success 200 {object} map[string]interface{} "Recovery codes"
+// @Failure 400 {object} map[string]string "Invalid code / Two-factor authentication is not enabled"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Router /user/2fa/recovery-codes [post]
+func (ctl *Controller) RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	var request m.TwoFactorCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	user := principal(r).User
+	if !user.TwoFactorEnabled {
+		http.Error(w, "Two-factor authentication is not enabled", http.StatusBadRequest)
+		return
+	}
+	ok, err := ctl.verifySecondFactor(r.Context(), user, request.Code)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		http.Error(w, "Invalid code", http.StatusBadRequest)
+		return
+	}
+	codes, err := ctl.replaceRecoveryCodes(r.Context(), user.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	response := map[string]interface{}{
+		"message":        "Recovery codes regenerated",
+		"recovery_codes": codes,
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// @Summary Complete two-factor login
+// @Description Exchange the challenge_token from POST /user/login and a TOTP or recovery code for an access and refresh token
+// @Param request body m.TwoFactorLoginRequest true "Challenge token and code"
+// @Success 200 {object} map[string]interface{} "Login successful"
+// @Failure 400 {object} map[string]string "Invalid request body"
+// @Failure 401 {object} map[string]string "Invalid or expired challenge token / Invalid code / Too many attempts"
+// @Failure 429 {object} map[string]string "Too many attempts for this account"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Router /user/login/2fa [post]
+func (ctl *Controller) LoginTwoFactor(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	var request m.TwoFactorLoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	claims, err := h.ParseChallengeToken(request.ChallengeToken)
+	if err != nil {
+		http.Error(w, "Invalid or expired challenge token", http.StatusUnauthorized)
+		return
+	}
+	userID, err := claims.UserID()
+	if err != nil {
+		http.Error(w, "Invalid or expired challenge token", http.StatusUnauthorized)
+		return
+	}
+	user, err := ctl.users.GetByID(r.Context(), userID)
+	if errors.Is(err, repository.ErrNotFound) || (err == nil && (user.Email != claims.Email || !user.TwoFactorEnabled)) {
+		http.Error(w, "Invalid or expired challenge token", http.StatusUnauthorized)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// Reserve the attempts before verifying, so parallel requests cannot all
+	// pass the checks before any of them fails. A password is enough for a
+	// new challenge, so the user count is what bounds the guesses.
+	userKey := strconv.Itoa(user.ID)
+	if !ctl.userAttempts.attempt(userKey, maxUserAttempts, time.Now().Add(userAttemptWindow)) {
+		slog.Warn("Two-factor attempt limit reached", "user_id", user.ID)
+		http.Error(w, "Too many attempts; try again later", http.StatusTooManyRequests)
+		return
+	}
+	if !ctl.challengeAttempts.attempt(claims.ID, maxChallengeAttempts, claims.ExpiresAt.Time) {
+		http.Error(w, "Too many attempts; log in again", http.StatusUnauthorized)
+		return
+	}
+
+	ok, err := ctl.verifySecondFactor(r.Context(), user, request.Code)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		http.Error(w, "Invalid code", http.StatusUnauthorized)
+		return
+	}
+	ctl.userAttempts.reset(userKey)
+	ctl.completeLogin(w, r, user)
+}
+
+// twoFactorRequired reports whether user may not go without two-factor
+// authentication.
+func (ctl *Controller) twoFactorRequired(user m.User) bool {
+	return ctl.opts.RequireAdminTwoFactor && user.RoleId == m.RoleAdmin
+}
+
+// verifySecondFactor accepts a TOTP code that was not used before or an
+// unused recovery code, consuming it.
+func (ctl *Controller) verifySecondFactor(ctx context.Context, user m.User, code string) (bool, error) {
+	if step, ok := h.ValidateTOTP(user.TOTPSecret, code, time.Now()); ok {
+		err := ctl.users.UseTOTPStep(ctx, user.ID, step)
+		if errors.Is(err, repository.ErrNotFound) {
+			return false, nil
+		}
+		return err == nil, err
+	}
+	if code == "" {
+		return false, nil
+	}
+	err := ctl.recoveryCodes.Use(ctx, user.ID, h.HashRecoveryCode(code))
+	if errors.Is(err, repository.ErrNotFound) {
+		return false, nil
+	}
+	if err == nil {
+		slog.Info("Recovery code used", "user_id", user.ID)
+	}
+	return err == nil, err
+}
+
+// replaceRecoveryCodes stores a new set of recovery codes for userID and
+// returns them in plain text.
+func (ctl *Controller) replaceRecoveryCodes(ctx context.Context, userID int) ([]string, error) {
+	codes, err := h.NewRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		return nil, err
+	}
+	now := m.NewMySQLTime(time.Now())
+	stored := make([]m.RecoveryCode, len(codes))
+	for i, code := range codes {
+		stored[i] = m.RecoveryCode{UserID: userID, CodeHash: h.HashRecoveryCode(code), CreatedAt: now}
+	}
+	if err := ctl.recoveryCodes.Replace(ctx, userID, stored); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// attemptCounter counts attempts per key until the key expires. It lives in
+// process memory, so each server instance keeps its own counts.
+type attemptCounter struct {
+	mu     sync.Mutex
+	counts map[string]attempts
+}
+
+type attempts struct {
+	made    int
+	expires time.Time
+}
+
+func newAttemptCounter() *attemptCounter {
+	return &attemptCounter{counts: make(map[string]attempts)}
+}
+
+// attempt records an attempt for key unless limit attempts were already
+// made; then it reports false. The count of key is forgotten at the expires
+// of its first attempt, so it covers a fixed window.
+func (c *attemptCounter) attempt(key string, limit int, expires time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	for k, a := range c.counts {
+		if now.After(a.expires) {
+			delete(c.counts, k)
+		}
+	}
+	a := c.counts[key]
+	if a.made >= limit {
+		return false
+	}
+	if a.made == 0 {
+		a.expires = expires
+	}
+	a.made++
+	c.counts[key] = a
+	return true
+}
+
+// reset forgets the attempts made for key.
+func (c *attemptCounter) reset(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.counts, key)
+}
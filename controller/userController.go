@@ -1,11 +1,13 @@
 package controller
 
 import (
-	"database/sql"
+	"context"
 	"encoding/json"
-	d "final-project/db"
+	"errors"
 	h "final-project/helper"
 	m "final-project/model"
+	"final-project/repository"
+	"log/slog"
 	"net/http"
 	"strconv"
 	"time"
@@ -14,35 +16,32 @@ import (
 	"golang.org/x/crypto/bcrypt"
 )
 
-var user m.User
-
 // @Summary Register new user
 // @Description Register a new user with the provided information
-// @Param user body m.User true "User object that needs to be registered"
-// @Success 200 {object} map[string]interface{} "Registration successful!"
+// @Param user body m.RegisterRequest true "Name, email and password of the new user"
+// @Success 200 {object} map[string]interface{} "Registration successful!" (with the new user as m.SelfUser)
 // @Failure 400 {object} map[string]string "Invalid request body" (when the request body does not contain valid JSON or is missing required fields)
 // @Failure 409 {object} map[string]string "Email already registered" (when the provided email is already registered)
 // @Failure 400 {object} map[string]string "Fill all the blank!" (when name, email, or password is empty)
 // @Failure 400 {object} map[string]string "Invalid Email" (when the provided email is not a valid email address)
-// @Failure 400 {object} map[string]string "Password should be at least 8 characters" (when the provided password is less than 8 characters)
+// @Failure 400 {object} map[string]string "Password should be at least 8 characters" (when the provided password does not satisfy the password policy)
 // @Failure 500 {object} map[string]string "Internal server error" (when there is a problem with the database or password hashing)
 // @Router /register [post]
-func Register(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
-	if err := json.NewDecoder(r.Body).Decode(&user); err != nil {
+func (ctl *Controller) Register(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	var request m.RegisterRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 	defer r.Body.Close()
-	var count int
-	err := d.Db.QueryRow("SELECT COUNT(*) FROM users WHERE email = ?", user.Email).Scan(&count)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-
-	if count > 0 {
+	user := m.User{Name: request.Name, Email: request.Email, Password: request.Password}
+	_, err := ctl.users.GetByEmail(r.Context(), user.Email)
+	if err == nil {
 		http.Error(w, "Email already registered", http.StatusConflict)
 		return
+	} else if !errors.Is(err, repository.ErrNotFound) {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
 	}
 	if user.Name == "" || user.Email == "" || user.Password == "" {
 		http.Error(w, "Fill all the blank!", http.StatusBadRequest)
@@ -54,41 +53,45 @@ func Register(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 		return
 	}
 
-	if len(user.Password) < 8 {
-		http.Error(w, "Password should be at least 8 characters", http.StatusBadRequest)
+	if err := h.ValidatePassword(user.Password); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
+	hashedPassword, err := h.HashPassword(user.Password)
 	if err != nil {
 		http.Error(w, "Failed to hash password", http.StatusInternalServerError)
 		return
 	}
 
-	user.Password = string(hashedPassword)
-	user.RoleId = 1
+	user.Password = hashedPassword
+	user.RoleId = m.RoleUser
 	user.AccessToken = ""
 	user.Active = false
+	user.EmailVerified = false
 	createdAt := m.NewMySQLTime(time.Now())
-	result, err := d.Db.Exec("INSERT INTO users (email, name, password, role_id, access_token,active,  created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
-		user.Email, user.Name, user.Password, user.RoleId, user.AccessToken, user.Active, createdAt, createdAt)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	user.CreatedAt = createdAt
+	user.UpdatedAt = createdAt
+	err = ctl.users.Create(r.Context(), &user)
+	if errors.Is(err, repository.ErrDuplicate) {
+		http.Error(w, "Email already registered", http.StatusConflict)
 		return
-	}
-
-	userID, err := result.LastInsertId()
-	if err != nil {
+	} else if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	user.ID = int(userID)
-	user.CreatedAt = createdAt
-	user.UpdatedAt = createdAt
+	message := "Registration successful!"
+	if ctl.opts.RequireVerifiedEmail {
+		// The account exists either way; the user can ask for another email.
+		if err := ctl.sendVerification(r.Context(), user); err != nil {
+			slog.Error("Failed to send verification email", "user_id", user.ID, "error", err)
+		}
+		message = "Registration successful! Check your email to verify your address"
+	}
 
 	response := map[string]interface{}{
-		"message": "Registration successful!",
-		"user":    user,
+		"message": message,
+		"user":    m.NewSelfUser(user),
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -97,46 +100,77 @@ func Register(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 
 // @Summary Login user
 // @Description Log in user with the provided credentials
-// @Param user body m.User true "User object that contains login credentials"
-// @Success 200 {object} map[string]interface{} "Login successful"
+// @Param user body m.LoginRequest true "Email and password"
+// @Success 200 {object} map[string]interface{} "Login successful with access_token, refresh_token and the user as m.SelfUser, or a challenge_token when two-factor authentication is enabled"
 // @Failure 400 {object} map[string]string "Invalid request body" (when the request body does not contain valid JSON or is missing required fields)
 // @Failure 401 {object} map[string]string "Unauthorized" (when the provided credentials are incorrect)
+// @Failure 403 {object} map[string]string "Email address is not verified" (when email verification is enabled and the user has not verified)
 // @Failure 500 {object} map[string]string "Failed to create JWT token" (when there is an error creating the JWT token)
 // @Failure 500 {object} map[string]string "Failed to update access token" (when there is an error updating the access token in the database)
 // @Router /login [post]
-func Login(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
-	var user m.User
-	if err := json.NewDecoder(r.Body).Decode(&user); err != nil {
+func (ctl *Controller) Login(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	var request m.LoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 	defer r.Body.Close()
-	registeredUser, err := h.GetUserByEmail(user.Email)
+	registeredUser, err := ctl.users.GetByEmail(r.Context(), request.Email)
 	if err != nil {
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
-	err = bcrypt.CompareHashAndPassword([]byte(registeredUser.Password), []byte(user.Password))
+	err = bcrypt.CompareHashAndPassword([]byte(registeredUser.Password), []byte(request.Password))
 	if err != nil {
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
-	token, err := h.CreateToken(registeredUser)
-	if err != nil {
-		http.Error(w, "Failed to create JWT token", http.StatusInternalServerError)
+	if ctl.opts.RequireVerifiedEmail && !registeredUser.EmailVerified {
+		http.Error(w, "Email address is not verified", http.StatusForbidden)
+		return
+	}
+	ctl.startLogin(w, r, registeredUser)
+}
+
+// startLogin follows a successful first factor: it answers with a
+// two-factor challenge when the user has enabled it and otherwise starts
+// the session.
+func (ctl *Controller) startLogin(w http.ResponseWriter, r *http.Request, user m.User) {
+	if user.TwoFactorEnabled {
+		// The first factor was right; the session starts at POST /user/login/2fa.
+		challenge, err := h.CreateChallengeToken(user)
+		if err != nil {
+			http.Error(w, "Failed to create JWT token", http.StatusInternalServerError)
+			return
+		}
+		response := map[string]interface{}{
+			"message":             "Two-factor authentication required",
+			"two_factor_required": true,
+			"challenge_token":     challenge,
+			"expires_in":          int(h.ChallengeTTL().Seconds()),
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
 		return
 	}
-	registeredUser.AccessToken = token
-	registeredUser.Active = true
-	updateTokenQuery := "UPDATE users SET access_token = ?, active = ? WHERE id = ?"
-	_, err = d.Db.Exec(updateTokenQuery, token, registeredUser.Active, registeredUser.ID)
+	ctl.completeLogin(w, r, user)
+}
+
+// completeLogin starts a session for user and writes the login response.
+// The tokens are top-level fields; the user never carries them.
+func (ctl *Controller) completeLogin(w http.ResponseWriter, r *http.Request, user m.User) {
+	token, refreshToken, err := ctl.issueTokens(r.Context(), r, user, "")
 	if err != nil {
-		http.Error(w, "Failed to update access token", http.StatusInternalServerError)
+		http.Error(w, "Failed to create JWT token", http.StatusInternalServerError)
 		return
 	}
 	response := map[string]interface{}{
-		"message": "Login successful",
-		"user":    registeredUser,
+		"message":       "Login successful",
+		"access_token":  token,
+		"token_type":    "Bearer",
+		"refresh_token": refreshToken,
+		"expires_in":    int(h.TokenTTL().Seconds()),
+		"user":          m.NewSelfUser(user),
 	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
@@ -145,37 +179,20 @@ func Login(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 // @Summary Get users
 // @Description Get a list of users with limited information based on the user's role
 // @Security ApiKeyAuth
-// @Success 200 {object} []m.UserResponse "List of users"
+// @Success 200 {object} []m.PublicUser "List of users"
 // @Failure 401 {object} map[string]string "Unauthorized" (when the provided JWT token is invalid or missing)
 // @Failure 500 {object} map[string]string "Internal server error" (when there is a problem with the database)
 // @Router /users [get]
-func GetUser(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
-	claims, err := h.Authenticate(r)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusUnauthorized)
-		return
-	}
-
-	_, ok := claims["id"].(float64)
-	if !ok {
-		http.Error(w, "Invalid token claims", http.StatusUnauthorized)
-		return
-	}
-	rows, err := d.Db.Query("SELECT name, role_id FROM users")
+func (ctl *Controller) GetUser(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	registered, err := ctl.users.List(r.Context())
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	defer rows.Close()
 
-	var users []m.UserResponse
-	for rows.Next() {
-		var user m.UserResponse
-		if err := rows.Scan(&user.Name, &user.RoleId); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
-		users = append(users, user)
+	users := []m.PublicUser{}
+	for _, user := range registered {
+		users = append(users, m.NewPublicUser(user))
 	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(users)
@@ -185,14 +202,14 @@ func GetUser(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 // @Description Get detailed information about a specific user (only accessible by admin)
 // @Param id path int true "User ID to be retrieved"
 // @Security ApiKeyAuth
-// @Success 200 {object} m.User "User details"
+// @Success 200 {object} m.AdminUser "User details"
 // @Failure 400 {object} map[string]string "Invalid userID" (when the provided user ID in the URL is not a valid integer)
 // @Failure 401 {object} map[string]string "Unauthorized" (when the provided JWT token is invalid or missing)
 // @Failure 403 {object} map[string]string "Access denied" (when the user does not have admin role)
 // @Failure 404 {object} map[string]string "User not found" (when the requested user ID does not exist in the database)
 // @Failure 500 {object} map[string]string "Internal server error" (when there is a problem with the database)
 // @Router /users/{id} [get]
-func GetUserDetail(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+func (ctl *Controller) GetUserDetail(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 
 	userID, err := strconv.Atoi(ps.ByName("id"))
 	if err != nil {
@@ -200,35 +217,26 @@ func GetUserDetail(w http.ResponseWriter, r *http.Request, ps httprouter.Params)
 		return
 	}
 
-	claims, err := h.Authenticate(r)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusUnauthorized)
-		return
-	}
-
-	//Check if the role claim exists and is equal to 2 (admin role)
-	if role, ok := claims["role"].(float64); !ok || role != 2 {
-		http.Error(w, "Access denied", http.StatusForbidden)
-		return
-	}
-
-	var existingUser m.User
-	err = d.Db.QueryRow("SELECT id, email, name, password, role_id, access_token, active, created_at, updated_at FROM users WHERE id = ?", userID).
-		Scan(&existingUser.ID, &existingUser.Email, &existingUser.Name, &existingUser.Password, &existingUser.RoleId, &existingUser.AccessToken, &existingUser.Active, &existingUser.CreatedAt, &existingUser.UpdatedAt)
-	if err == sql.ErrNoRows {
+	existingUser, err := ctl.users.GetByID(r.Context(), userID)
+	if errors.Is(err, repository.ErrNotFound) {
 		http.Error(w, "User not found", http.StatusNotFound)
 		return
 	} else if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	active, err := ctl.hasSession(r.Context(), existingUser.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(existingUser)
+	json.NewEncoder(w).Encode(m.NewAdminUser(existingUser, active))
 }
 
 // @Summary Delete user
-// @Description Delete a user by its ID (only accessible by admin)
+// @Description Delete a user by its ID (only accessible by admin). Their reviews are anonymized or deleted as DELETED_USER_REVIEWS says.
 // @Param id path int true "User ID to be deleted"
 // @Security ApiKeyAuth
 // @Success 200 {object} map[string]string "User successfully deleted"
@@ -236,42 +244,41 @@ func GetUserDetail(w http.ResponseWriter, r *http.Request, ps httprouter.Params)
 // @Failure 401 {object} map[string]string "Unauthorized" (when the provided JWT token is invalid or missing)
 // @Failure 403 {object} map[string]string "Access denied" (when the user does not have admin role)
 // @Failure 404 {object} map[string]string "User not found" (when the requested user ID does not exist in the database)
+// @Failure 409 {object} map[string]string "This is the last user who can manage users"
 // @Failure 500 {object} map[string]string "Internal server error" (when there is a problem with the database)
 // @Router /users/{id} [delete]
-func DeleteUser(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+func (ctl *Controller) DeleteUser(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 
 	userID, err := strconv.Atoi(ps.ByName("id"))
 	if err != nil {
 		http.Error(w, "Invalid userID", http.StatusBadRequest)
 		return
 	}
-	claims, err := h.Authenticate(r)
+	existingUser, err := ctl.users.GetByID(r.Context(), userID)
+	if errors.Is(err, repository.ErrNotFound) {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	last, err := ctl.isLastAdmin(r.Context(), existingUser)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusUnauthorized)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-
-	// Check if the role claim exists and is equal to 2 (admin role)
-	if role, ok := claims["role"].(float64); !ok || role != 2 {
-		http.Error(w, "Access denied", http.StatusForbidden)
+	if last {
+		http.Error(w, "This is the last user who can manage users", http.StatusConflict)
 		return
 	}
-	var existingUser m.User
-	err = d.Db.QueryRow("SELECT id, email, name, password, role_id, access_token, active, created_at, updated_at FROM users WHERE id = ?", userID).
-		Scan(&existingUser.ID, &existingUser.Email, &existingUser.Name, &existingUser.Password, &existingUser.RoleId, &existingUser.AccessToken, &existingUser.Active, &existingUser.CreatedAt, &existingUser.UpdatedAt)
-	if err == sql.ErrNoRows {
+	err = ctl.users.Delete(r.Context(), userID, ctl.opts.AnonymizeReviews)
+	if errors.Is(err, repository.ErrNotFound) {
 		http.Error(w, "User not found", http.StatusNotFound)
 		return
 	} else if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-
-	_, err = d.Db.Exec("DELETE FROM users WHERE id = ?", userID)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
 	response := map[string]string{
 		"message": "User successfully deleted",
 	}
@@ -280,41 +287,43 @@ func DeleteUser(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	json.NewEncoder(w).Encode(response)
 }
 
-// @Summary Update user
-// @Description Update user data (name and password)
+// @Summary Change user role
+// @Description Assign a role to a user (only accessible by admin). The new role applies from the user's next request.
+// @Param id path int true "User ID"
+// @Param role body m.UserRoleRequest true "Role to assign"
 // @Security ApiKeyAuth
-// @Param user body m.User true "User object that contains updated user data"
-// @Success 200 {object} map[string]interface{} "User data updated"
-// @Failure 400 {object} map[string]string "Invalid request body" (when the request body does not contain valid JSON or is missing required fields)
+// @Success 200 {object} map[string]interface{} "User role updated"
+// @Failure 400 {object} map[string]string "Invalid userID / Role not found"
 // @Failure 401 {object} map[string]string "Unauthorized" (when the provided JWT token is invalid or missing)
+// @Failure 403 {object} map[string]string "Access denied" (when the user does not have admin role)
+// @Failure 404 {object} map[string]string "User not found" (when the requested user ID does not exist in the database)
+// @Failure 409 {object} map[string]string "This is the last user who can manage users"
 // @Failure 500 {object} map[string]string "Internal server error" (when there is a problem with the database)
-// @Router /users [put]
-func UpdateUser(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
-	var user m.User
-	if err := json.NewDecoder(r.Body).Decode(&user); err != nil {
+// @Router /user/{id}/role [put]
+func (ctl *Controller) UpdateUserRole(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	userID, err := strconv.Atoi(ps.ByName("id"))
+	if err != nil {
+		http.Error(w, "Invalid userID", http.StatusBadRequest)
+		return
+	}
+	var request m.UserRoleRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 	defer r.Body.Close()
 
-	// Authenticate and extract UserID from JWT
-	claims, err := h.Authenticate(r)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusUnauthorized)
+	role, err := ctl.roles.GetByID(r.Context(), request.RoleID)
+	if errors.Is(err, repository.ErrNotFound) {
+		http.Error(w, "Role not found", http.StatusBadRequest)
 		return
-	}
-	var existingUser m.User
-
-	userIDFloat, ok := claims["id"].(float64)
-	if !ok {
-		http.Error(w, "Invalid token claims", http.StatusUnauthorized)
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	userID := int(userIDFloat)
 
-	err = d.Db.QueryRow("SELECT id, email, name, password, role_id, access_token, active, created_at, updated_at FROM users WHERE id = ?", userID).
-		Scan(&existingUser.ID, &existingUser.Email, &existingUser.Name, &existingUser.Password, &existingUser.RoleId, &existingUser.AccessToken, &existingUser.Active, &existingUser.CreatedAt, &existingUser.UpdatedAt)
-	if err == sql.ErrNoRows {
+	existingUser, err := ctl.users.GetByID(r.Context(), userID)
+	if errors.Is(err, repository.ErrNotFound) {
 		http.Error(w, "User not found", http.StatusNotFound)
 		return
 	} else if err != nil {
@@ -322,58 +331,101 @@ func UpdateUser(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 		return
 	}
 
-	createdAt := m.NewMySQLTime(time.Now())
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
+	// Stops the role change from locking everyone out of user management.
+	manager, err := ctl.permissions.HasPermission(r.Context(), role.ID, m.PermManageUsers)
 	if err != nil {
-		http.Error(w, "Failed to hash password", http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	user.Password = string(hashedPassword)
+	if !manager {
+		last, err := ctl.isLastAdmin(r.Context(), existingUser)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if last {
+			http.Error(w, "This is the last user who can manage users", http.StatusConflict)
+			return
+		}
+	}
 
-	_, err = d.Db.Exec("UPDATE users SET name = ?, password = ?, updated_at = ? WHERE id = ?",
-		user.Name, user.Password, createdAt, userID)
+	existingUser.RoleId = role.ID
+	existingUser.UpdatedAt = m.NewMySQLTime(time.Now())
+	err = ctl.users.UpdateRole(r.Context(), existingUser)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	existingUser.Name = user.Name
-	existingUser.Password = user.Password
-	existingUser.UpdatedAt = createdAt
-
 	response := map[string]interface{}{
-		"message": "User data updated",
-		"review":  existingUser,
+		"message": "User role updated",
+		"user_id": existingUser.ID,
+		"role":    role,
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
 }
 
-// @Summary Logout user
-// @Description Log out user by clearing the access token
+// @Summary Update user
+// @Description Update the user's name. Passwords are changed with POST /user/password.
 // @Security ApiKeyAuth
-// @Success 200 {object} map[string]string "Logout successful"
+// @Param user body m.UpdateUserRequest true "New name"
+// @Success 200 {object} map[string]interface{} "User data updated" (with the user as m.SelfUser)
+// @Failure 400 {object} map[string]string "Invalid request body" (when the request body does not contain valid JSON or is missing required fields)
+// @Failure 400 {object} map[string]string "Use POST /user/password to change the password" (when the body contains a password)
 // @Failure 401 {object} map[string]string "Unauthorized" (when the provided JWT token is invalid or missing)
 // @Failure 500 {object} map[string]string "Internal server error" (when there is a problem with the database)
-// @Router /logout [post]
-func Logout(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
-	claims, err := h.Authenticate(r)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusUnauthorized)
+// @Router /users [put]
+func (ctl *Controller) UpdateUser(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	var request m.UpdateUserRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	// Changing the password needs the current one, see ChangePassword.
+	if request.Password != "" {
+		http.Error(w, "Use POST /user/password to change the password", http.StatusBadRequest)
+		return
+	}
+	if request.Name == "" {
+		http.Error(w, "Fill all the blank!", http.StatusBadRequest)
 		return
 	}
 
-	userIDFloat, ok := claims["id"].(float64)
-	if !ok {
-		http.Error(w, "Invalid token claims", http.StatusUnauthorized)
+	existingUser := principal(r).User
+	existingUser.Name = request.Name
+	existingUser.UpdatedAt = m.NewMySQLTime(time.Now())
+	err := ctl.users.UpdateProfile(r.Context(), existingUser)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	userID := int(userIDFloat)
+	response := map[string]interface{}{
+		"message": "User data updated",
+		"user":    m.NewSelfUser(existingUser),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// @Summary Logout user
+// @Description Log out user by ending the session of the presented access token and revoking its refresh tokens
+// @Security ApiKeyAuth
+// @Success 200 {object} map[string]string "Logout successful"
+// @Failure 401 {object} map[string]string "Unauthorized" (when the provided JWT token is invalid or missing)
+// @Failure 500 {object} map[string]string "Internal server error" (when there is a problem with the database)
+// @Router /logout [post]
+func (ctl *Controller) Logout(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	caller := principal(r)
 
-	// Clear the access token and set active to false for the user in the database
-	_, err = d.Db.Exec("UPDATE users SET access_token = '', active = false WHERE id = ?", userID)
+	// End this device's session; its access and refresh tokens stop working
+	// while the user's other sessions stay signed in.
+	err := ctl.revokeSession(r.Context(), caller.Claims.SessionID)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -386,3 +438,16 @@ func Logout(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
 }
+
+// reissueTokens signs userID out of every session and starts a new one for
+// the current client.
+func (ctl *Controller) reissueTokens(ctx context.Context, r *http.Request, userID int) (string, string, error) {
+	if err := ctl.signOutEverywhere(ctx, userID); err != nil {
+		return "", "", err
+	}
+	user, err := ctl.users.GetByID(ctx, userID)
+	if err != nil {
+		return "", "", err
+	}
+	return ctl.issueTokens(ctx, r, user, "")
+}
@@ -0,0 +1,121 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	h "final-project/helper"
+	"final-project/mailer"
+	m "final-project/model"
+	"final-project/repository"
+	"log/slog"
+	"net/http"
+	"net/url"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// @Summary Verify email
+// @Description Confirm the email address of an account with the token from the verification email
+// @Param token query string true "Verification token"
+// @Success 200 {object} map[string]string "Email verified"
+// @Failure 400 {object} map[string]string "Invalid or expired verification token"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Router /user/verify [get]
+func (ctl *Controller) VerifyEmail(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	claims, err := h.ParseVerificationToken(r.URL.Query().Get("token"))
+	if err != nil {
+		http.Error(w, "Invalid or expired verification token", http.StatusBadRequest)
+		return
+	}
+	userID, err := claims.UserID()
+	if err != nil {
+		http.Error(w, "Invalid or expired verification token", http.StatusBadRequest)
+		return
+	}
+	user, err := ctl.users.GetByID(r.Context(), userID)
+	// A token for an address the account no longer uses proves nothing.
+	if errors.Is(err, repository.ErrNotFound) || (err == nil && user.Email != claims.Email) {
+		http.Error(w, "Invalid or expired verification token", http.StatusBadRequest)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	message := "Email already verified"
+	if !user.EmailVerified {
+		if err := ctl.users.MarkEmailVerified(r.Context(), user.ID); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		message = "Email verified"
+	}
+
+	response := map[string]string{
+		"message": message,
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// @Summary Resend verification email
+// @Description Send a new verification email. The response is the same whether or not the address is registered and whether or not the email could be sent.
+// @Param request body m.ResendVerificationRequest true "Email address"
+// @Success 202 {object} map[string]string "Verification email sent"
+// @Failure 400 {object} map[string]string "Invalid request body"
+// @Failure 404 {object} map[string]string "Email verification is not enabled"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Router /user/verify/resend [post]
+func (ctl *Controller) ResendVerification(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	if !ctl.opts.RequireVerifiedEmail {
+		http.Error(w, "Email verification is not enabled", http.StatusNotFound)
+		return
+	}
+	var request m.ResendVerificationRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	user, err := ctl.users.GetByEmail(r.Context(), request.Email)
+	if err != nil && !errors.Is(err, repository.ErrNotFound) {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err == nil && !user.EmailVerified {
+		// A failure must not tell the caller that the address is registered.
+		if err := ctl.sendVerification(r.Context(), user); err != nil {
+			slog.Error("Failed to send verification email", "user_id", user.ID, "error", err)
+		}
+	}
+
+	response := map[string]string{
+		"message": "If the address belongs to an unverified account, a verification email has been sent",
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(response)
+}
+
+// sendVerification mails user a link to VerifyEmail.
+func (ctl *Controller) sendVerification(ctx context.Context, user m.User) error {
+	token, err := h.CreateVerificationToken(user)
+	if err != nil {
+		return err
+	}
+	link := ctl.opts.BaseURL + "/user/verify?token=" + url.QueryEscape(token)
+	err = ctl.opts.Mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Verify your email address",
+		Body: "Hi " + user.Name + ",\n\n" +
+			"Open this link to verify your email address:\n\n" + link + "\n\n" +
+			"If you did not create an account, you can ignore this email.\n",
+	})
+	if err != nil {
+		return err
+	}
+	slog.Info("Sent verification email", "user_id", user.ID)
+	return nil
+}
@@ -1,11 +1,10 @@
 package controller
 
 import (
-	"database/sql"
 	"encoding/json"
-	d "final-project/db"
-	h "final-project/helper"
+	"errors"
 	m "final-project/model"
+	"final-project/repository"
 	"net/http"
 	"strconv"
 	"time"
@@ -25,7 +24,7 @@ import (
 // @Failure 400 {object} map[string]string "The Game is already exists in your list" (when the game is already present in the user's wishlist)
 // @Failure 500 {object} map[string]string "Internal server error" (when there is a problem with the database)
 // @Router /wishlist [post]
-func AddWish(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+func (ctl *Controller) AddWish(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 	var wishlist m.Wishlist
 	if err := json.NewDecoder(r.Body).Decode(&wishlist); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
@@ -34,55 +33,39 @@ func AddWish(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 	defer r.Body.Close()
 
 	// Authenticate and extract UserID from JWT
-	claims, err := h.Authenticate(r)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusUnauthorized)
-		return
-	}
-
-	userIDFloat, ok := claims["id"].(float64)
-	if !ok {
-		http.Error(w, "Invalid token claims", http.StatusUnauthorized)
-		return
-	}
+	caller := principal(r)
 
-	userID := int(userIDFloat)
+	userID := caller.User.ID
 
 	if wishlist.GameID <= 0 {
 		http.Error(w, "Invalid game ID", http.StatusBadRequest)
 		return
 	}
 
-	var count int
-	err = d.Db.QueryRow("SELECT COUNT(*) FROM wishlists WHERE game_id = ? AND user_id = ?", wishlist.GameID, userID).Scan(&count)
+	wished, err := ctl.wishlists.Exists(r.Context(), userID, wishlist.GameID)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	if count > 0 {
+	if wished {
 		http.Error(w, "The Game is already exists in your list", http.StatusBadRequest)
 		return
 	}
 
 	createdAt := m.NewMySQLTime(time.Now())
 	wishlist.UserID = userID
-	result, err := d.Db.Exec("INSERT INTO wishlists (user_id, game_id, created_at, updated_at) VALUES (?, ?, ?, ?)",
-		wishlist.UserID, wishlist.GameID, createdAt, createdAt)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	wishlist.CreatedAt = createdAt
+	wishlist.UpdatedAt = createdAt
+	err = ctl.wishlists.Create(r.Context(), &wishlist)
+	if errors.Is(err, repository.ErrDuplicate) {
+		http.Error(w, "The Game is already exists in your list", http.StatusBadRequest)
 		return
-	}
-	wishID, err := result.LastInsertId()
-	if err != nil {
+	} else if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	wishlist.ID = int(wishID)
-	wishlist.CreatedAt = createdAt
-	wishlist.UpdatedAt = createdAt
-
 	response := map[string]interface{}{
 		"message": "wish added",
 		"wish":    wishlist,
@@ -100,34 +83,14 @@ func AddWish(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 // @Failure 401 {object} map[string]string "Unauthorized" (when the JWT token is missing or invalid)
 // @Failure 500 {object} map[string]string "Internal server error" (when there is a problem with the database)
 // @Router /wishlist [get]
-func GetWish(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
-	claims, err := h.Authenticate(r)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusUnauthorized)
-		return
-	}
+func (ctl *Controller) GetWish(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+	caller := principal(r)
 
-	userID, ok := claims["id"].(float64)
-	if !ok {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
-		return
-	}
-	rows, err := d.Db.Query("SELECT w.id, w.user_id, g.title AS game_title, w.created_at, w.updated_at FROM wishlists w JOIN games g ON w.game_id = g.id WHERE w.user_id = ?", userID)
+	wishes, err := ctl.wishlists.ListByUser(r.Context(), caller.User.ID)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	defer rows.Close()
-
-	var wishes []m.WishlistWithGameTitle
-	for rows.Next() {
-		var wish m.WishlistWithGameTitle
-		if err := rows.Scan(&wish.ID, &wish.UserID, &wish.GameTitle, &wish.CreatedAt, &wish.UpdatedAt); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
-		wishes = append(wishes, wish)
-	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(wishes)
 }
@@ -144,33 +107,22 @@ func GetWish(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 // @Failure 404 {object} map[string]string "Wishlist item not found" (when the specified wishlist item ID does not exist in the database)
 // @Failure 500 {object} map[string]string "Internal server error" (when there is a problem with the database)
 // @Router /wishlist/{id} [delete]
-func DeleteWish(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+func (ctl *Controller) DeleteWish(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 	wishID, err := strconv.Atoi(ps.ByName("id"))
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	claims, err := h.Authenticate(r)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusUnauthorized)
-		return
-	}
-	userID, ok := claims["id"].(float64)
-	if !ok {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
-		return
-	}
-	var existingWish m.Wishlist
-	err = d.Db.QueryRow("SELECT id, user_id, game_id, created_at, updated_at from wishlists where id = ? AND user_id = ?", wishID, userID).
-		Scan(&existingWish.ID, &existingWish.UserID, &existingWish.GameID, &existingWish.CreatedAt, &existingWish.UpdatedAt)
-	if err == sql.ErrNoRows {
+	caller := principal(r)
+	existingWish, err := ctl.wishlists.GetForUser(r.Context(), wishID, caller.User.ID)
+	if errors.Is(err, repository.ErrNotFound) {
 		http.Error(w, "Wish not found", http.StatusNotFound)
 		return
 	} else if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	_, err = d.Db.Exec("DELETE FROM wishlists WHERE id = ? AND user_id = ?", existingWish.ID, existingWish.UserID)
+	err = ctl.wishlists.Delete(r.Context(), existingWish.ID)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
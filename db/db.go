@@ -1,29 +1,101 @@
 package db
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
+	"log/slog"
 	"net/http"
+	"net/url"
+	"time"
 
-	_ "github.com/go-sql-driver/mysql"
+	"final-project/config"
+
+	"github.com/go-sql-driver/mysql"
 	"github.com/julienschmidt/httprouter"
+	_ "modernc.org/sqlite"
 )
 
-var Db *sql.DB
+// Store owns the database connection pool shared by the handlers.
+type Store struct {
+	*sql.DB
+	// Driver is the database/sql driver name, "mysql" or "sqlite".
+	Driver string
+}
 
-func init() {
-	// DB Connection
-	var err error
-	Db, err = sql.Open("mysql", "root:@tcp(localhost:3306)/finalprojectdb")
+// Open connects to the configured database, retrying with exponential
+// backoff until it answers or cfg.DBConnectTimeout elapses.
+func Open(ctx context.Context, cfg *config.Config) (*Store, error) {
+	driver, dsn := "mysql", cfg.DatabaseDSN
+	if cfg.StorageDriver == "sqlite" {
+		driver, dsn = "sqlite", sqliteDSN(cfg.SQLitePath)
+	} else {
+		var err error
+		if dsn, err = mysqlDSN(dsn); err != nil {
+			return nil, err
+		}
+	}
+	db, err := sql.Open(driver, dsn)
 	if err != nil {
-		panic(err)
+		return nil, err
+	}
+	db.SetMaxOpenConns(cfg.DBMaxOpenConns)
+	db.SetMaxIdleConns(cfg.DBMaxIdleConns)
+	db.SetConnMaxLifetime(cfg.DBConnMaxLifetime)
+
+	ctx, cancel := context.WithTimeout(ctx, cfg.DBConnectTimeout)
+	defer cancel()
+
+	backoff := 500 * time.Millisecond
+	for attempt := 1; ; attempt++ {
+		err = db.PingContext(ctx)
+		if err == nil {
+			break
+		}
+		slog.Warn("Database not reachable, retrying", "attempt", attempt, "backoff", backoff, "error", err)
+		select {
+		case <-ctx.Done():
+			db.Close()
+			return nil, fmt.Errorf("db: giving up after %d attempts: %w", attempt, err)
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > 10*time.Second {
+			backoff = 10 * time.Second
+		}
 	}
+	if driver == "sqlite" {
+		slog.Info("Opened SQLite database", "path", cfg.SQLitePath)
+	} else {
+		slog.Info("Connected to MySQL database!")
+	}
+	return &Store{DB: db, Driver: driver}, nil
+}
 
-	err = Db.Ping()
+// mysqlDSN makes MySQL report the rows an UPDATE matched rather than the
+// ones it changed, as SQLite does. The repositories read zero affected rows
+// as "not found", which a write that changes nothing must not trigger.
+func mysqlDSN(dsn string) (string, error) {
+	mysqlCfg, err := mysql.ParseDSN(dsn)
 	if err != nil {
-		panic(err)
+		return "", fmt.Errorf("db: DB_DSN: %w", err)
 	}
-	fmt.Println("Connected to MySQL database!")
+	mysqlCfg.ClientFoundRows = true
+	return mysqlCfg.FormatDSN(), nil
+}
+
+// sqliteDSN enables foreign keys, which SQLite leaves off by default, and
+// waits on locks instead of failing fast when several requests write at once.
+func sqliteDSN(path string) string {
+	query := url.Values{}
+	query.Add("_pragma", "foreign_keys(1)")
+	query.Add("_pragma", "busy_timeout(5000)")
+	query.Add("_pragma", "journal_mode(WAL)")
+	return "file:" + path + "?" + query.Encode()
+}
+
+// Close releases the connection pool.
+func (s *Store) Close() error {
+	return s.DB.Close()
 }
 
 func RootHandler(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
@@ -0,0 +1,41 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+func TestMySQLDSN(t *testing.T) {
+	tests := []struct {
+		name    string
+		dsn     string
+		wantErr bool
+	}{
+		{name: "plain", dsn: "root:@tcp(localhost:3306)/finalprojectdb"},
+		{name: "with options", dsn: "root:@tcp(localhost:3306)/finalprojectdb?parseTime=true"},
+		{name: "found rows turned off", dsn: "root:@tcp(localhost:3306)/finalprojectdb?clientFoundRows=false"},
+		{name: "invalid", dsn: "root:@tcp(localhost:3306", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dsn, err := mysqlDSN(tt.dsn)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("mysqlDSN(%q) = %q, want an error", tt.dsn, dsn)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("mysqlDSN(%q) error = %v", tt.dsn, err)
+			}
+			cfg, err := mysql.ParseDSN(dsn)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !cfg.ClientFoundRows {
+				t.Errorf("mysqlDSN(%q) = %q, want clientFoundRows=true", tt.dsn, dsn)
+			}
+		})
+	}
+}
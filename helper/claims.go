@@ -0,0 +1,81 @@
+package helper
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Claims are the claims of an access token. RegisteredClaims carries iss,
+// sub, aud, exp, iat and jti.
+type Claims struct {
+	UserID       int    `json:"id"`
+	Email        string `json:"email"`
+	RoleID       int    `json:"role"`
+	TokenVersion int    `json:"ver"`
+	SessionID    string `json:"sid"`
+	jwt.RegisteredClaims
+}
+
+// Validate is called by the parser after the registered claims passed.
+func (c *Claims) Validate() error {
+	if c.UserID <= 0 || c.SessionID == "" || c.ID == "" {
+		return errors.New("missing token claims")
+	}
+	return nil
+}
+
+// Purposes of the signed tokens that are not access tokens.
+const (
+	// purposeVerifyEmail marks the token mailed to confirm an address.
+	purposeVerifyEmail = "verify_email"
+	// purposeTwoFactor marks the challenge returned by the first login step
+	// of an account with two-factor authentication.
+	purposeTwoFactor = "2fa_challenge"
+	// purposeOIDCState marks the cookie that carries an OpenID Connect login
+	// from the redirect to the callback.
+	purposeOIDCState = "oidc_state"
+)
+
+// PurposeClaims are the claims of a single-purpose token such as an email
+// verification link. The subject is the user id; Email ties the token to
+// the address it was issued for.
+type PurposeClaims struct {
+	Email   string `json:"email"`
+	Purpose string `json:"purpose"`
+	jwt.RegisteredClaims
+}
+
+// Validate keeps access tokens from being accepted as a purpose token. The
+// parser checks the purpose itself.
+func (c *PurposeClaims) Validate() error {
+	if c.Purpose == "" || c.Subject == "" || c.Email == "" {
+		return errors.New("missing token claims")
+	}
+	return nil
+}
+
+// UserID returns the id of the user the token was issued to.
+func (c *PurposeClaims) UserID() (int, error) {
+	return strconv.Atoi(c.Subject)
+}
+
+// OIDCStateClaims tie an OpenID Connect callback to the browser that
+// started the login: the state and nonce sent to the provider, and the PKCE
+// verifier that redeems the code.
+type OIDCStateClaims struct {
+	State    string `json:"state"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+	Purpose  string `json:"purpose"`
+	jwt.RegisteredClaims
+}
+
+// Validate keeps other tokens from being accepted as login state.
+func (c *OIDCStateClaims) Validate() error {
+	if c.Purpose != purposeOIDCState || c.State == "" || c.Nonce == "" || c.Verifier == "" {
+		return errors.New("missing token claims")
+	}
+	return nil
+}
@@ -1,19 +1,89 @@
 package helper
 
 import (
-	"database/sql"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"errors"
-	d "final-project/db"
+	"final-project/config"
 	m "final-project/model"
+	"final-project/repository"
 	"fmt"
 	"net/http"
 	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
-	"github.com/dgrijalva/jwt-go"
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/crypto/bcrypt"
 )
 
+var (
+	jwtSecret       []byte
+	jwtIssuer       string
+	jwtAudience     string
+	tokenTTL        time.Duration
+	refreshTokenTTL time.Duration
+	verificationTTL time.Duration
+	resetTTL        time.Duration
+	challengeTTL    time.Duration
+	totpIssuer      = "final-project"
+	bcryptCost      = bcrypt.DefaultCost
+	users           repository.UserRepository
+	sessions        repository.SessionRepository
+	// keys signs tokens when JWT_ALGORITHM is RS256 or EdDSA; nil means
+	// HS256 with jwtSecret.
+	keys *keySet
+)
+
+// ErrTokenRevoked is returned by Authenticate for a token whose session was
+// signed out, that was invalidated by a password change or that belongs to a
+// deleted user.
+var ErrTokenRevoked = errors.New("token has been revoked")
+
+// Configure injects the token and password settings used by this package and
+// loads the signing keys, generating the first one if the directory is empty.
+func Configure(cfg *config.Config) error {
+	jwtSecret = []byte(cfg.JWTSecret)
+	jwtIssuer = cfg.JWTIssuer
+	jwtAudience = cfg.JWTAudience
+	tokenTTL = cfg.TokenTTL
+	refreshTokenTTL = cfg.RefreshTokenTTL
+	verificationTTL = cfg.EmailVerificationTTL
+	resetTTL = cfg.PasswordResetTTL
+	challengeTTL = cfg.TwoFactorChallengeTTL
+	totpIssuer = cfg.TOTPIssuer
+	bcryptCost = cfg.BcryptCost
+	configurePasswordPolicy(cfg)
+
+	keys = nil
+	if cfg.JWTAlgorithm == "HS256" {
+		return nil
+	}
+	var err error
+	keys, err = loadKeySet(cfg.JWTKeysDir, cfg.JWTActiveKID, cfg.JWTAlgorithm, keyRetention(cfg.JWTKeyRotation))
+	return err
+}
+
+// UseRepositories gives Authenticate the stored users and sessions it checks
+// every token against.
+func UseRepositories(userRepo repository.UserRepository, sessionRepo repository.SessionRepository) {
+	users = userRepo
+	sessions = sessionRepo
+}
+
+// HashPassword hashes password with the configured bcrypt cost.
+func HashPassword(password string) (string, error) {
+	hashed, err := bcrypt.GenerateFromPassword([]byte(password), bcryptCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hashed), nil
+}
+
 //Email validation
 
 func IsValidEmail(email string) bool {
@@ -28,157 +98,274 @@ func IsValidEmail(email string) bool {
 }
 
 // JWT
-func CreateToken(user m.User) (string, error) {
-	claims := jwt.MapClaims{
-		"id":    user.ID,
-		"email": user.Email,
-		"role":  user.RoleId,
-		"exp":   time.Now().Add(time.Hour * 24).Unix(), // Token kadaluwarsa setelah 24 jam
+func CreateToken(user m.User, sessionID string) (string, error) {
+	jti, err := RandomToken(16)
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	claims := Claims{
+		UserID:       user.ID,
+		Email:        user.Email,
+		RoleID:       user.RoleId,
+		TokenVersion: user.TokenVersion,
+		SessionID:    sessionID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    jwtIssuer,
+			Subject:   strconv.Itoa(user.ID),
+			Audience:  jwt.ClaimStrings{jwtAudience},
+			ExpiresAt: jwt.NewNumericDate(now.Add(tokenTTL)),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ID:        jti,
+		},
 	}
+	return sign(claims)
+}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte("secret-key"))
+// CreateVerificationToken returns a signed token that confirms user's
+// current email address until it expires.
+func CreateVerificationToken(user m.User) (string, error) {
+	return createPurposeToken(user, purposeVerifyEmail, verificationTTL)
 }
 
-func ExtractToken(r *http.Request) (string, error) {
-	tokenString := r.Header.Get("Authorization")
-	if tokenString == "" {
-		return "", errors.New("Authorization token not provided")
-	}
+// CreateChallengeToken returns the short-lived token that the second login
+// step exchanges, together with a TOTP or recovery code, for a session.
+func CreateChallengeToken(user m.User) (string, error) {
+	return createPurposeToken(user, purposeTwoFactor, challengeTTL)
+}
 
-	// The token is usually sent in the format "Bearer <token>"
-	// We will remove the "Bearer " prefix to get the actual token
-	tokenString = strings.Replace(tokenString, "Bearer ", "", 1)
+// ChallengeTTL is the lifetime of the tokens made by CreateChallengeToken.
+func ChallengeTTL() time.Duration {
+	return challengeTTL
+}
 
-	return tokenString, nil
+// oidcStateTTL is how long the provider's login page may take.
+const oidcStateTTL = 10 * time.Minute
+
+// CreateOIDCState signs the state of an OpenID Connect login for the
+// browser to keep in a cookie until the callback.
+func CreateOIDCState(state, nonce, verifier string) (string, error) {
+	now := time.Now()
+	return sign(OIDCStateClaims{
+		State:    state,
+		Nonce:    nonce,
+		Verifier: verifier,
+		Purpose:  purposeOIDCState,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    jwtIssuer,
+			Audience:  jwt.ClaimStrings{jwtAudience},
+			ExpiresAt: jwt.NewNumericDate(now.Add(oidcStateTTL)),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+	})
 }
 
-func Authenticate(r *http.Request) (jwt.MapClaims, error) {
-	tokenString, err := ExtractToken(r)
-	if err != nil {
-		return nil, err
+// OIDCStateTTL is the lifetime of the tokens made by CreateOIDCState.
+func OIDCStateTTL() time.Duration {
+	return oidcStateTTL
+}
+
+// ParseOIDCState verifies a token made by CreateOIDCState and returns its
+// claims.
+func ParseOIDCState(tokenString string) (*OIDCStateClaims, error) {
+	claims := &OIDCStateClaims{}
+	if err := parse(tokenString, claims); err != nil {
+		return nil, errors.New("invalid or expired login state")
 	}
+	return claims, nil
+}
 
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, errors.New("unexpected signing method")
-		}
-		return []byte("secret-key"), nil // Replace "secret-key" with your actual secret key
-	})
+func createPurposeToken(user m.User, purpose string, ttl time.Duration) (string, error) {
+	jti, err := RandomToken(16)
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	claims := PurposeClaims{
+		Email:   user.Email,
+		Purpose: purpose,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    jwtIssuer,
+			Subject:   strconv.Itoa(user.ID),
+			Audience:  jwt.ClaimStrings{jwtAudience},
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ID:        jti,
+		},
+	}
+	return sign(claims)
+}
 
-	if err != nil || !token.Valid {
-		return nil, errors.New("invalid or expired token")
+// sign signs claims with the shared secret in HS256 mode, otherwise with the
+// active key, naming it in the kid header.
+func sign(claims jwt.Claims) (string, error) {
+	if keys == nil {
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+		return token.SignedString(jwtSecret)
 	}
+	key := keys.signing()
+	token := jwt.NewWithClaims(key.method, claims)
+	token.Header["kid"] = key.id
+	return token.SignedString(key.private)
+}
 
-	claims, ok := token.Claims.(jwt.MapClaims)
+// verificationKey picks the key for token: the shared secret in HS256 mode,
+// otherwise the public key named by its kid header.
+func verificationKey(token *jwt.Token) (interface{}, error) {
+	if keys == nil {
+		return jwtSecret, nil
+	}
+	kid, _ := token.Header["kid"].(string)
+	key, ok := keys.verification(kid)
 	if !ok {
-		return nil, errors.New("invalid token claims")
+		return nil, errors.New("unknown signing key")
+	}
+	if token.Method.Alg() != key.method.Alg() {
+		return nil, errors.New("unexpected signing method")
 	}
+	return key.private.Public(), nil
+}
 
+// ParseToken verifies the signature, algorithm, issuer, audience and expiry
+// of an access token and returns its claims.
+func ParseToken(tokenString string) (*Claims, error) {
+	claims := &Claims{}
+	if err := parse(tokenString, claims); err != nil {
+		return nil, errors.New("invalid or expired token")
+	}
 	return claims, nil
 }
 
-func AuthenticateRole(roleId int, next http.HandlerFunc) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		tokenString := r.Header.Get("Authorization")
-		if tokenString == "" {
-			http.Error(w, "Authorization token not provided", http.StatusUnauthorized)
-			return
-		}
-
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-			}
-			return []byte("secret-key"), nil
-		})
-
-		if err != nil || !token.Valid {
-			http.Error(w, "Invalid or expired token", http.StatusUnauthorized)
-			return
-		}
+// ParseVerificationToken verifies a token made by CreateVerificationToken
+// and returns its claims.
+func ParseVerificationToken(tokenString string) (*PurposeClaims, error) {
+	claims := &PurposeClaims{}
+	if err := parse(tokenString, claims); err != nil || claims.Purpose != purposeVerifyEmail {
+		return nil, errors.New("invalid or expired verification token")
+	}
+	return claims, nil
+}
 
-		claims, ok := token.Claims.(jwt.MapClaims)
-		if !ok {
-			http.Error(w, "Invalid token claims", http.StatusUnauthorized)
-			return
-		}
+// ParseChallengeToken verifies a token made by CreateChallengeToken and
+// returns its claims.
+func ParseChallengeToken(tokenString string) (*PurposeClaims, error) {
+	claims := &PurposeClaims{}
+	if err := parse(tokenString, claims); err != nil || claims.Purpose != purposeTwoFactor {
+		return nil, errors.New("invalid or expired challenge token")
+	}
+	return claims, nil
+}
 
-		roleIdFromToken, ok := claims["role"].(int64)
-		if !ok || int(roleIdFromToken) != roleId {
-			http.Error(w, "Access denied", http.StatusForbidden)
-			return
-		}
-		next(w, r)
+func parse(tokenString string, claims jwt.Claims) error {
+	methods := []string{jwt.SigningMethodHS256.Alg()}
+	if keys != nil {
+		methods = []string{jwt.SigningMethodRS256.Alg(), jwt.SigningMethodEdDSA.Alg()}
 	}
+	_, err := jwt.ParseWithClaims(tokenString, claims, verificationKey,
+		jwt.WithValidMethods(methods),
+		jwt.WithIssuer(jwtIssuer),
+		jwt.WithAudience(jwtAudience),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+	)
+	return err
 }
 
-// Get Email
-func GetUserByEmail(email string) (m.User, error) {
-	query := "SELECT id, email, name, password, role_id, access_token, active, created_at, updated_at FROM users WHERE email = ?"
-	var user m.User
-	err := d.Db.QueryRow(query, email).Scan(&user.ID, &user.Email, &user.Name, &user.Password, &user.RoleId, &user.AccessToken, &user.Active, &user.CreatedAt, &user.UpdatedAt)
-	if err != nil {
-		if err == sql.ErrNoRows {
-			return m.User{}, fmt.Errorf("Unauthorized access")
-		}
+// TokenTTL is the lifetime of the access tokens made by CreateToken.
+func TokenTTL() time.Duration {
+	return tokenTTL
+}
 
-		return m.User{}, err
-	}
+// RefreshTokenExpiry is the expiry of a refresh token issued now.
+func RefreshTokenExpiry() time.Time {
+	return time.Now().Add(refreshTokenTTL)
+}
 
-	return user, nil
+// PasswordResetExpiry is the expiry of a password reset token issued now.
+func PasswordResetExpiry() time.Time {
+	return time.Now().Add(resetTTL)
 }
 
-func IsUserRole(userID int, roleID int) bool {
-	query := "SELECT role_id FROM users WHERE id = ?"
-	var userRoleID int
-	err := d.Db.QueryRow(query, userID).Scan(&userRoleID)
-	if err != nil {
-		if err == sql.ErrNoRows {
-			return false
-		}
-		fmt.Println("Error:", err)
-		return false
+// RandomToken returns n random bytes as unpadded base64url, for opaque
+// tokens such as refresh tokens.
+func RandomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
 	}
-	return userRoleID == roleID
+	return base64.RawURLEncoding.EncodeToString(b), nil
 }
 
-func GetUserIDFromToken(r *http.Request) (int, bool) {
+// HashToken returns the hex SHA-256 of an opaque token. Only this hash is
+// stored, so a leaked table cannot be replayed.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func ExtractToken(r *http.Request) (string, error) {
 	tokenString := r.Header.Get("Authorization")
 	if tokenString == "" {
-		return 0, false
+		return "", errors.New("Authorization token not provided")
 	}
 
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, errors.New("unexpected signing method")
-		}
-		return []byte("secret-key"), nil
-	})
+	// The token is usually sent in the format "Bearer <token>"
+	// We will remove the "Bearer " prefix to get the actual token
+	tokenString = strings.Replace(tokenString, "Bearer ", "", 1)
 
-	if err != nil || !token.Valid {
-		return 0, false
-	}
+	return tokenString, nil
+}
 
-	claims, ok := token.Claims.(jwt.MapClaims)
-	if !ok {
-		return 0, false
+// Authenticate returns the claims of the request's bearer token and the
+// stored user they belong to, after checking both against the user's token
+// version and session. Handlers get them from the principal the
+// authentication middleware stores instead.
+func Authenticate(r *http.Request) (*Claims, m.User, error) {
+	tokenString, err := ExtractToken(r)
+	if err != nil {
+		return nil, m.User{}, err
 	}
-
-	userIDFloat, ok := claims["id"].(float64)
-	if !ok {
-		return 0, false
+	claims, err := ParseToken(tokenString)
+	if err != nil {
+		return nil, m.User{}, err
 	}
-
-	userID := int(userIDFloat)
-	return userID, true
+	user, err := checkRevoked(r.Context(), claims)
+	if err != nil {
+		return nil, m.User{}, err
+	}
+	return claims, user, nil
 }
 
-func IsGameExists(gameID int) (bool, error) {
-	var count int
-	err := d.Db.QueryRow("SELECT COUNT(*) FROM games WHERE id = ?", gameID).Scan(&count)
-	if err != nil {
-		return false, err
+// checkRevoked loads the user of claims, compares the token version with
+// the user's current one and makes sure the session is still signed in.
+func checkRevoked(ctx context.Context, claims *Claims) (m.User, error) {
+	if users == nil {
+		return m.User{}, errors.New("helper: UseRepositories has not been called")
+	}
+	user, err := users.GetByID(ctx, claims.UserID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return m.User{}, ErrTokenRevoked
+	} else if err != nil {
+		return m.User{}, err
+	}
+	if user.TokenVersion != claims.TokenVersion {
+		return m.User{}, ErrTokenRevoked
+	}
+
+	session, err := sessions.GetByID(ctx, claims.SessionID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return m.User{}, ErrTokenRevoked
+	} else if err != nil {
+		return m.User{}, err
+	}
+	if session.Revoked || session.UserID != user.ID {
+		return m.User{}, ErrTokenRevoked
 	}
-	return count > 0, nil
+	// Only write last_seen_at about once a minute per session.
+	if now := time.Now(); now.Sub(session.LastSeenAt.Time) > time.Minute {
+		if err := sessions.Touch(ctx, session.ID, m.NewMySQLTime(now)); err != nil {
+			return m.User{}, err
+		}
+	}
+	return user, nil
 }
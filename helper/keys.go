@@ -0,0 +1,302 @@
+package helper
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// signingKey is one private key of the key set, named by its kid.
+type signingKey struct {
+	id      string
+	method  jwt.SigningMethod
+	private crypto.Signer
+	created time.Time
+}
+
+// keyCheckInterval is how often RotateKeys reloads the key directory.
+const keyCheckInterval = time.Minute
+
+// keySet holds the PEM keys of a directory. Each file <kid>.pem is a
+// PKCS#8 RSA or Ed25519 private key; every key verifies tokens and the
+// active one signs them. With a positive retention, keys that stopped
+// signing long enough ago for their tokens to have expired are deleted.
+type keySet struct {
+	mu        sync.RWMutex
+	dir       string
+	activeKID string
+	algorithm string
+	retention time.Duration
+	keys      map[string]*signingKey
+	active    *signingKey
+}
+
+func loadKeySet(dir, activeKID, algorithm string, retention time.Duration) (*keySet, error) {
+	ks := &keySet{dir: dir, activeKID: activeKID, algorithm: algorithm, retention: retention}
+	if err := ks.reload(); err != nil {
+		return nil, err
+	}
+	if activeKID != "" {
+		if ks.active == nil {
+			return nil, fmt.Errorf("jwt keys: active key %q not found in %s", activeKID, dir)
+		}
+		return ks, nil
+	}
+	// Switching JWT_ALGORITHM starts signing with a fresh key of that kind;
+	// the old keys keep verifying.
+	if ks.active == nil || ks.active.method.Alg() != algorithm {
+		if err := ks.generate(); err != nil {
+			return nil, err
+		}
+	}
+	return ks, nil
+}
+
+// reload re-reads the directory so keys added by another instance are
+// accepted. Without a configured kid the newest key by name signs, so
+// generated keys are named by their creation time. Keys past the retention
+// are dropped and their files removed.
+func (ks *keySet) reload() error {
+	entries, err := os.ReadDir(ks.dir)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("jwt keys: %w", err)
+	}
+
+	keys := make(map[string]*signingKey)
+	var ids []string
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".pem" {
+			continue
+		}
+		key, err := readKey(filepath.Join(ks.dir, entry.Name()))
+		if err != nil {
+			return err
+		}
+		keys[key.id] = key
+		ids = append(ids, key.id)
+	}
+	sort.Strings(ids)
+
+	var active *signingKey
+	if ks.activeKID != "" {
+		active = keys[ks.activeKID]
+	} else if len(ids) > 0 {
+		active = keys[ids[len(ids)-1]]
+	}
+	for id, key := range keys {
+		if ks.retention <= 0 || key == active || time.Since(key.created) <= ks.retention {
+			continue
+		}
+		// A leaked key must not verify forever, and the JWKS would grow
+		// with every rotation.
+		delete(keys, id)
+		err := os.Remove(filepath.Join(ks.dir, id+".pem"))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			slog.Error("Failed to remove retired JWT key", "kid", id, "error", err)
+			continue
+		}
+		slog.Info("Removed retired JWT signing key", "kid", id)
+	}
+
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	ks.keys = keys
+	ks.active = active
+	return nil
+}
+
+func readKey(path string) (*signingKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("jwt keys: %w", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("jwt keys: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("jwt keys: %s is not PEM", path)
+	}
+
+	var parsed interface{}
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	default:
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("jwt keys: %s: %w", path, err)
+	}
+
+	key := &signingKey{
+		id:      strings.TrimSuffix(filepath.Base(path), ".pem"),
+		created: info.ModTime(),
+	}
+	switch private := parsed.(type) {
+	case *rsa.PrivateKey:
+		key.method, key.private = jwt.SigningMethodRS256, private
+	case ed25519.PrivateKey:
+		key.method, key.private = jwt.SigningMethodEdDSA, private
+	default:
+		return nil, fmt.Errorf("jwt keys: %s: unsupported key type %T", path, parsed)
+	}
+	return key, nil
+}
+
+// generate writes a new key for the configured algorithm and makes it active.
+func (ks *keySet) generate() error {
+	var private interface{}
+	var err error
+	switch ks.algorithm {
+	case "RS256":
+		private, err = rsa.GenerateKey(rand.Reader, 2048)
+	case "EdDSA":
+		_, private, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		err = fmt.Errorf("cannot generate %s keys", ks.algorithm)
+	}
+	if err != nil {
+		return fmt.Errorf("jwt keys: %w", err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return fmt.Errorf("jwt keys: %w", err)
+	}
+
+	if err := os.MkdirAll(ks.dir, 0o700); err != nil {
+		return fmt.Errorf("jwt keys: %w", err)
+	}
+	// The random suffix keeps instances that rotate in the same second from
+	// writing different keys under one kid.
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return fmt.Errorf("jwt keys: %w", err)
+	}
+	kid := time.Now().UTC().Format("20060102T150405Z") + "-" + hex.EncodeToString(suffix)
+	path := filepath.Join(ks.dir, kid+".pem")
+	data := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		return fmt.Errorf("jwt keys: %w", err)
+	}
+	slog.Info("Generated JWT signing key", "kid", kid, "algorithm", ks.algorithm)
+	return ks.reload()
+}
+
+func (ks *keySet) signing() *signingKey {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	return ks.active
+}
+
+func (ks *keySet) verification(kid string) (*signingKey, bool) {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	key, ok := ks.keys[kid]
+	return key, ok
+}
+
+// RotateKeys reloads the key directory every minute and, when interval is
+// positive, generates a new signing key once the active one is older than
+// interval. Previous keys keep verifying tokens until every token they
+// signed has expired; then they are removed and no longer published. It
+// returns when ctx is done.
+func RotateKeys(ctx context.Context, interval time.Duration) {
+	if keys == nil {
+		return
+	}
+	ticker := time.NewTicker(keyCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if err := keys.reload(); err != nil {
+			slog.Error("Failed to reload JWT keys", "error", err)
+			continue
+		}
+		if active := keys.signing(); interval > 0 && (active == nil || time.Since(active.created) >= interval) {
+			if err := keys.generate(); err != nil {
+				slog.Error("Failed to rotate JWT key", "error", err)
+			}
+		}
+	}
+}
+
+// keyRetention is how long after its creation a key may still verify
+// tokens when keys rotate every interval: it signs until its successor
+// takes over, and its last tokens live for the longest token lifetime.
+// Rotation and reloads run on a one-minute tick, so another instance can
+// sign with a key for up to two ticks past the interval.
+func keyRetention(interval time.Duration) time.Duration {
+	if interval <= 0 {
+		return 0
+	}
+	longest := oidcStateTTL
+	for _, ttl := range []time.Duration{tokenTTL, verificationTTL, challengeTTL} {
+		if ttl > longest {
+			longest = ttl
+		}
+	}
+	return interval + longest + 2*keyCheckInterval
+}
+
+// JWK is the public half of a signing key as published in the JWKS.
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// JWKS returns the public keys that verify tokens, for other services to
+// fetch. It is empty when tokens are signed with the shared HS256 secret.
+func JWKS() []JWK {
+	jwks := []JWK{}
+	if keys == nil {
+		return jwks
+	}
+	keys.mu.RLock()
+	defer keys.mu.RUnlock()
+	for _, key := range keys.keys {
+		jwk := JWK{Kid: key.id, Use: "sig", Alg: key.method.Alg()}
+		switch public := key.private.Public().(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(public)
+		}
+		jwks = append(jwks, jwk)
+	}
+	sort.Slice(jwks, func(i, j int) bool { return jwks[i].Kid < jwks[j].Kid })
+	return jwks
+}
@@ -0,0 +1,100 @@
+package helper
+
+import (
+	_ "embed"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"final-project/config"
+)
+
+// commonPasswordList is bundled so the check works without network access.
+//
+//go:embed common_passwords.txt
+var commonPasswordList string
+
+var commonPasswords = func() map[string]bool {
+	set := make(map[string]bool)
+	for _, line := range strings.Split(commonPasswordList, "\n") {
+		if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") {
+			set[line] = true
+		}
+	}
+	return set
+}()
+
+// maxPasswordBytes is the longest input bcrypt accepts.
+const maxPasswordBytes = 72
+
+// PasswordPolicy is the set of rules a new password must satisfy.
+type PasswordPolicy struct {
+	MinLength     int
+	RequireUpper  bool
+	RequireLower  bool
+	RequireDigit  bool
+	RequireSymbol bool
+	// RejectCommon refuses passwords from the bundled common password list.
+	RejectCommon bool
+}
+
+var passwordPolicy = PasswordPolicy{MinLength: 8, RejectCommon: true}
+
+func configurePasswordPolicy(cfg *config.Config) {
+	passwordPolicy = PasswordPolicy{
+		MinLength:     cfg.PasswordMinLength,
+		RequireUpper:  cfg.PasswordRequireUpper,
+		RequireLower:  cfg.PasswordRequireLower,
+		RequireDigit:  cfg.PasswordRequireDigit,
+		RequireSymbol: cfg.PasswordRequireSymbol,
+		RejectCommon:  cfg.PasswordRejectCommon,
+	}
+}
+
+// ValidatePassword checks password against the configured policy. The error
+// message is meant for the user.
+func ValidatePassword(password string) error {
+	policy := passwordPolicy
+	if len([]rune(password)) < policy.MinLength {
+		return fmt.Errorf("Password should be at least %d characters", policy.MinLength)
+	}
+	if len(password) > maxPasswordBytes {
+		return fmt.Errorf("Password should be at most %d bytes", maxPasswordBytes)
+	}
+
+	var upper, lower, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r) || unicode.IsSpace(r):
+			symbol = true
+		}
+	}
+	var missing []string
+	if policy.RequireUpper && !upper {
+		missing = append(missing, "an uppercase letter")
+	}
+	if policy.RequireLower && !lower {
+		missing = append(missing, "a lowercase letter")
+	}
+	if policy.RequireDigit && !digit {
+		missing = append(missing, "a digit")
+	}
+	if policy.RequireSymbol && !symbol {
+		missing = append(missing, "a symbol")
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("Password should contain %s", strings.Join(missing, ", "))
+	}
+
+	if policy.RejectCommon && commonPasswords[strings.ToLower(password)] {
+		return errors.New("Password is too common")
+	}
+	return nil
+}
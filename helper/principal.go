@@ -0,0 +1,29 @@
+package helper
+
+import (
+	"context"
+
+	m "final-project/model"
+)
+
+// Principal is the authenticated caller of a request: the verified token
+// claims and the user they belong to, as loaded for this request. Requests
+// authenticated with an API key carry APIKey instead of Claims.
+type Principal struct {
+	User   m.User
+	Claims *Claims
+	APIKey *m.APIKey
+}
+
+type principalKey struct{}
+
+// ContextWithPrincipal returns a copy of ctx carrying principal.
+func ContextWithPrincipal(ctx context.Context, principal *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+// PrincipalFromContext returns the principal stored by ContextWithPrincipal.
+func PrincipalFromContext(ctx context.Context) (*Principal, bool) {
+	principal, ok := ctx.Value(principalKey{}).(*Principal)
+	return principal, ok
+}
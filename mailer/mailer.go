@@ -0,0 +1,77 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"final-project/config"
+)
+
+// Message is a plain-text email.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers messages. Implementations must be safe for concurrent use.
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// New returns the mailer selected by cfg.Mailer.
+func New(cfg *config.Config) (Mailer, error) {
+	switch cfg.Mailer {
+	case "log":
+		return &LogMailer{From: cfg.MailFrom}, nil
+	case "file":
+		if err := os.MkdirAll(cfg.MailDir, 0o700); err != nil {
+			return nil, fmt.Errorf("mailer: %w", err)
+		}
+		return &FileMailer{Dir: cfg.MailDir, From: cfg.MailFrom}, nil
+	default:
+		return nil, fmt.Errorf("mailer: unknown mailer %q", cfg.Mailer)
+	}
+}
+
+// LogMailer writes every message to the log instead of sending it, for
+// local development.
+type LogMailer struct {
+	From string
+}
+
+func (ml *LogMailer) Send(_ context.Context, msg Message) error {
+	slog.Info("Mail", "from", ml.From, "to", msg.To, "subject", msg.Subject, "body", msg.Body)
+	return nil
+}
+
+// FileMailer writes every message as an .eml file into Dir, where a mail
+// client or a test can pick it up.
+type FileMailer struct {
+	Dir  string
+	From string
+	seq  atomic.Int64
+}
+
+func (ml *FileMailer) Send(_ context.Context, msg Message) error {
+	now := time.Now()
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", ml.From)
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", msg.Subject)
+	fmt.Fprintf(&b, "Date: %s\r\n", now.Format(time.RFC1123Z))
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+
+	name := fmt.Sprintf("%s-%d.eml", now.UTC().Format("20060102T150405.000000000Z"), ml.seq.Add(1))
+	if err := os.WriteFile(filepath.Join(ml.Dir, name), []byte(b.String()), 0o600); err != nil {
+		return fmt.Errorf("mailer: %w", err)
+	}
+	return nil
+}
@@ -1,9 +1,26 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"final-project/config"
 	c "final-project/controller"
 	d "final-project/db"
+	h "final-project/helper"
+	"final-project/mailer"
+	mw "final-project/middleware"
+	m "final-project/model"
+	"final-project/oidc"
+	"final-project/repository"
+	"final-project/seed"
+	"fmt"
+	"log/slog"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	// Bundled so profile time zones validate on hosts without zoneinfo.
+	_ "time/tzdata"
 
 	_ "final-project/docs"
 
@@ -11,37 +28,202 @@ import (
 )
 
 func main() {
+	cfg, err := config.Load()
+	if err != nil {
+		slog.Error("Invalid configuration", "error", err)
+		os.Exit(1)
+	}
+	level, _ := cfg.SlogLevel()
+	slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level})))
+
+	command, args := "serve", os.Args[1:]
+	if len(args) > 0 {
+		command, args = args[0], args[1:]
+	}
+	switch command {
+	case "serve":
+		err = serve(cfg)
+	case "migrate":
+		err = runMigrate(cfg, args)
+	case "seed":
+		err = runSeed(cfg, args)
+	case "mock-oidc":
+		err = runMockOIDC(cfg, args)
+	default:
+		err = fmt.Errorf("unknown command %q (want serve, migrate, seed or mock-oidc)", command)
+	}
+	if err != nil {
+		slog.Error("Command failed", "command", command, "error", err)
+		os.Exit(1)
+	}
+}
+
+// serve runs the HTTP server until SIGINT/SIGTERM, then drains in-flight
+// requests and closes the database.
+func serve(cfg *config.Config) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := h.Configure(cfg); err != nil {
+		return err
+	}
+	go h.RotateKeys(ctx, cfg.JWTKeyRotation)
+	repos, closeStorage, err := openStorage(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer closeStorage()
+	h.UseRepositories(repos.Users, repos.Sessions)
+	if cfg.SeedOnStart {
+		if err := seed.Run(ctx, repos, seedOptions(cfg)); err != nil {
+			return err
+		}
+	}
+
+	mail, err := mailer.New(cfg)
+	if err != nil {
+		return err
+	}
+	authn := mw.NewAuthenticator(repos.Users, repos.APIKeys)
+	authz := mw.NewAuthorizer(authn, repos.Permissions, cfg.RequireAdminTwoFactor)
+	ctl := c.New(repos, c.Options{
+		Mailer:                mail,
+		RequireVerifiedEmail:  cfg.EmailVerification,
+		BaseURL:               cfg.BaseURL,
+		PasswordResetURL:      cfg.PasswordResetURL,
+		RequireAdminTwoFactor: cfg.RequireAdminTwoFactor,
+		OIDC:                  oidc.New(cfg),
+		AnonymizeReviews:      cfg.DeletedUserReviews == "anonymize",
+		Authorizer:            authz,
+	})
+	server := &http.Server{
+		Addr:    cfg.Addr,
+		Handler: mw.CORS(cfg.CORSOrigins, newRouter(ctl, authn, authz)),
+	}
+	serveErr := make(chan error, 1)
+	go func() {
+		slog.Info("Listening", "addr", cfg.Addr, "env", cfg.Env)
+		serveErr <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serveErr:
+		return err
+	case <-ctx.Done():
+	}
+
+	slog.Info("Shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	ctl.Wait()
+	return nil
+}
+
+// openStorage builds the repositories for cfg.StorageDriver. The returned
+// func releases the backend and is safe to defer.
+func openStorage(ctx context.Context, cfg *config.Config) (*repository.Repositories, func() error, error) {
+	if cfg.StorageDriver == "memory" {
+		slog.Warn("Using in-memory storage; data is lost on restart")
+		return repository.NewMemory(), func() error { return nil }, nil
+	}
+
+	store, err := d.Open(ctx, cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	if cfg.MigrateOnStart {
+		if err := migrateUp(ctx, store); err != nil {
+			store.Close()
+			return nil, nil, err
+		}
+	}
+	if store.Driver == "sqlite" {
+		return repository.NewSQLite(store.DB), store.Close, nil
+	}
+	return repository.NewMySQL(store.DB), store.Close, nil
+}
+
+// newRouter declares every route. Routes wrapped in authn.Require need a
+// signed-in user or an API key with the account scope; authn.RequireSession
+// refuses API keys; authz.Require needs the named permission on the caller's
+// role, and among the scopes of an API key.
+func newRouter(ctl *c.Controller, authn *mw.Authenticator, authz *mw.Authorizer) *httprouter.Router {
 	router := httprouter.New()
 	//User
-	router.POST("/user", c.Register)
-	router.POST("/user/login", c.Login)
-	router.POST("/user/logout", c.Logout)
-	router.GET("/user", c.GetUser)
-	router.GET("/user/detail/:id", c.GetUserDetail)
-	router.POST("/user/update/:id", c.UpdateUser)
-	router.DELETE("/user/:id", c.DeleteUser)
+	router.POST("/user", ctl.Register)
+	router.POST("/user/login", ctl.Login)
+	router.GET("/user/oidc/login", ctl.OIDCLogin)
+	router.GET("/user/oidc/callback", ctl.OIDCCallback)
+	router.GET("/user/verify", ctl.VerifyEmail)
+	router.POST("/user/verify/resend", ctl.ResendVerification)
+	router.POST("/user/password/forgot", ctl.ForgotPassword)
+	router.POST("/user/password/reset", ctl.ResetPassword)
+	router.POST("/user/logout", authn.RequireSession(ctl.Logout))
+	router.POST("/user/token/refresh", ctl.RefreshToken)
+	router.GET("/sessions", authn.RequireSession(ctl.GetSessions))
+	router.DELETE("/sessions", authn.RequireSession(ctl.RevokeOtherSessions))
+	router.DELETE("/session/:id", authn.RequireSession(ctl.RevokeSession))
+	router.GET("/api-keys", authn.RequireSession(ctl.GetAPIKeys))
+	router.POST("/api-keys", authn.RequireSession(ctl.CreateAPIKey))
+	router.DELETE("/api-key/:id", authn.RequireSession(ctl.RevokeAPIKey))
+	router.GET("/user", authn.Require(ctl.GetUser))
+	router.GET("/user/detail/:id", authz.Require(m.PermViewUsers, ctl.GetUserDetail))
+	router.PATCH("/user/me", authn.Require(ctl.PatchProfile))
+	router.GET("/user/me/export", authn.RequireSession(ctl.ExportAccount))
+	router.PATCH("/user/detail/:id", authz.Require(m.PermManageUsers, ctl.PatchUserProfile))
+	router.POST("/user/update/:id", authn.Require(ctl.UpdateUser))
+	router.POST("/user/password", authn.RequireSession(ctl.ChangePassword))
+	router.POST("/user/login/2fa", ctl.LoginTwoFactor)
+	router.GET("/user/2fa", authn.RequireSession(ctl.GetTwoFactor))
+	router.POST("/user/2fa/setup", authn.RequireSession(ctl.SetupTwoFactor))
+	router.POST("/user/2fa/enable", authn.RequireSession(ctl.EnableTwoFactor))
+	router.POST("/user/2fa/disable", authn.RequireSession(ctl.DisableTwoFactor))
+	router.POST("/user/2fa/recovery-codes", authn.RequireSession(ctl.RegenerateRecoveryCodes))
+	router.DELETE("/user/:id", meOr(authn.RequireSession(ctl.DeleteAccount), authz.Require(m.PermManageUsers, ctl.DeleteUser)))
+	router.PUT("/user/:id/role", authz.Require(m.PermManageUsers, ctl.UpdateUserRole))
 	//Role
-	router.POST("/role", c.CreateRole)
-	router.DELETE("/role/:id", c.DeleteRole)
-	router.GET("/roles", c.GetRole)
+	router.POST("/role", authz.Require(m.PermManageRoles, ctl.CreateRole))
+	router.PUT("/role/:id", authz.Require(m.PermManageRoles, ctl.UpdateRole))
+	router.DELETE("/role/:id", authz.Require(m.PermManageRoles, ctl.DeleteRole))
+	router.GET("/roles", authz.Require(m.PermManageRoles, ctl.GetRole))
+	router.GET("/permissions", authz.Require(m.PermManageRoles, ctl.GetPermissions))
+	router.GET("/role/:id/permissions", authz.Require(m.PermManageRoles, ctl.GetRolePermissions))
+	router.POST("/role/:id/permissions", authz.Require(m.PermManageRoles, ctl.GrantPermission))
+	router.DELETE("/role/:id/permissions/:permission", authz.Require(m.PermManageRoles, ctl.RevokePermission))
 	//Game
-	router.POST("/game", c.AddGame)
-	router.GET("/games", c.GetGames)
-	router.GET("/game-detail/:id", c.GetGameDetail)
-	router.POST("/game-update/:id", c.UpdateGame)
-	router.DELETE("/game/:id", c.DeleteGame)
+	router.POST("/game", authz.Require(m.PermManageGames, ctl.AddGame))
+	router.GET("/games", ctl.GetGames)
+	router.GET("/game-detail/:id", ctl.GetGameDetail)
+	router.POST("/game-update/:id", authz.Require(m.PermManageGames, ctl.UpdateGame))
+	router.DELETE("/game/:id", authz.Require(m.PermManageGames, ctl.DeleteGame))
 	//Review
-	router.POST("/game/review", c.AddReview)
-	router.GET("/game/reviews", c.GetReview)
-	router.POST("/review/:id", c.UpdateReview)
-	router.DELETE("/review/:uid", c.DeleteReview)
+	router.POST("/game/review", authn.Require(ctl.AddReview))
+	router.GET("/game/reviews", authn.Require(ctl.GetReview))
+	router.POST("/review/:id", authn.Require(ctl.UpdateReview))
+	router.DELETE("/review/:id", authn.Require(ctl.DeleteReview))
 	//Wishlist
-	router.POST("/game-wish", c.AddWish)
-	router.GET("/game-wish", c.GetWish)
-	router.DELETE("/game-wish/delete/:id", c.DeleteWish)
+	router.POST("/game-wish", authn.Require(ctl.AddWish))
+	router.GET("/game-wish", authn.Require(ctl.GetWish))
+	router.DELETE("/game-wish/delete/:id", authn.Require(ctl.DeleteWish))
 	//Root
+	router.GET("/.well-known/jwks.json", ctl.GetJWKS)
 	router.GET("/", d.RootHandler)
 	// Swagger UI files
 	router.ServeFiles("/swagger/*filepath", http.Dir("./docs"))
-	http.ListenAndServe(":8080", router)
+	return router
+}
+
+// meOr serves /user/me with self and every other id with other, since
+// httprouter cannot register a static segment beside a parameter.
+func meOr(self, other httprouter.Handle) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		if ps.ByName("id") == "me" {
+			self(w, r, ps)
+			return
+		}
+		other(w, r, ps)
+	}
 }
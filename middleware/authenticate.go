@@ -0,0 +1,113 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	h "final-project/helper"
+	m "final-project/model"
+	"final-project/repository"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// APIKeyHeader carries a personal API key instead of a bearer token.
+const APIKeyHeader = "X-API-Key"
+
+// touchInterval limits how often the last use of an API key is written.
+const touchInterval = time.Minute
+
+// Authenticator resolves the bearer token or API key of a request once and
+// stores the caller in the request context for handlers to read with
+// h.PrincipalFromContext.
+type Authenticator struct {
+	users   repository.UserRepository
+	apiKeys repository.APIKeyRepository
+}
+
+func NewAuthenticator(users repository.UserRepository, apiKeys repository.APIKeyRepository) *Authenticator {
+	return &Authenticator{users: users, apiKeys: apiKeys}
+}
+
+// Require only calls next when the request carries a valid, unrevoked token
+// of an existing user, or an API key with the account scope.
+func (a *Authenticator) Require(next httprouter.Handle) httprouter.Handle {
+	return a.authenticated(func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		principal, _ := h.PrincipalFromContext(r.Context())
+		if principal.APIKey != nil && !principal.APIKey.Scopes.Has(m.ScopeAccount) {
+			http.Error(w, "API key is missing the "+m.ScopeAccount+" scope", http.StatusForbidden)
+			return
+		}
+		next(w, r, ps)
+	})
+}
+
+// RequireSession is Require for routes that act on the signed-in session or
+// manage credentials, which an API key must not reach.
+func (a *Authenticator) RequireSession(next httprouter.Handle) httprouter.Handle {
+	return a.authenticated(func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		principal, _ := h.PrincipalFromContext(r.Context())
+		if principal.APIKey != nil {
+			http.Error(w, "API keys cannot be used here; sign in instead", http.StatusForbidden)
+			return
+		}
+		next(w, r, ps)
+	})
+}
+
+// authenticated stores the principal and calls next without checking any
+// scope.
+func (a *Authenticator) authenticated(next httprouter.Handle) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		var principal *h.Principal
+		var status int
+		var err error
+		if key := r.Header.Get(APIKeyHeader); key != "" {
+			principal, status, err = a.fromAPIKey(r, key)
+		} else {
+			principal, status, err = a.fromToken(r)
+		}
+		if err != nil {
+			http.Error(w, err.Error(), status)
+			return
+		}
+		next(w, r.WithContext(h.ContextWithPrincipal(r.Context(), principal)), ps)
+	}
+}
+
+func (a *Authenticator) fromToken(r *http.Request) (*h.Principal, int, error) {
+	// Authenticate already loads the user to check the token version.
+	claims, user, err := h.Authenticate(r)
+	if err != nil {
+		return nil, http.StatusUnauthorized, err
+	}
+	return &h.Principal{User: user, Claims: claims}, 0, nil
+}
+
+// fromAPIKey accepts an unrevoked, unexpired key and records when it was
+// last used.
+func (a *Authenticator) fromAPIKey(r *http.Request, key string) (*h.Principal, int, error) {
+	apiKey, err := a.apiKeys.GetByHash(r.Context(), h.HashToken(key))
+	if errors.Is(err, repository.ErrNotFound) || (err == nil && (apiKey.Revoked || time.Now().After(apiKey.ExpiresAt.Time))) {
+		return nil, http.StatusUnauthorized, errors.New("Invalid or expired API key")
+	} else if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	user, err := a.users.GetByID(r.Context(), apiKey.UserID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, http.StatusUnauthorized, errors.New("Invalid or expired API key")
+	} else if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+
+	now := time.Now()
+	if apiKey.LastUsedAt == nil || now.Sub(apiKey.LastUsedAt.Time) >= touchInterval {
+		lastUsed := m.NewMySQLTime(now)
+		if err := a.apiKeys.Touch(r.Context(), apiKey.ID, lastUsed); err != nil {
+			return nil, http.StatusInternalServerError, err
+		}
+		apiKey.LastUsedAt = &lastUsed
+	}
+	return &h.Principal{User: user, APIKey: &apiKey}, 0, nil
+}
@@ -0,0 +1,72 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+
+	h "final-project/helper"
+	m "final-project/model"
+	"final-project/repository"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// Authorizer guards routes with permissions resolved from the role of the
+// authenticated user through the role_permissions table.
+type Authorizer struct {
+	authn       *Authenticator
+	permissions repository.PermissionRepository
+	// requireAdminTwoFactor denies every permission to admins that have not
+	// enabled two-factor authentication.
+	requireAdminTwoFactor bool
+}
+
+func NewAuthorizer(authn *Authenticator, permissions repository.PermissionRepository, requireAdminTwoFactor bool) *Authorizer {
+	return &Authorizer{authn: authn, permissions: permissions, requireAdminTwoFactor: requireAdminTwoFactor}
+}
+
+// Require authenticates the request like Authenticator.Require and only calls
+// next when the principal is allowed permission, see Allows.
+func (a *Authorizer) Require(permission string, next httprouter.Handle) httprouter.Handle {
+	return a.authn.authenticated(func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		principal, _ := h.PrincipalFromContext(r.Context())
+		denied, err := a.denial(r.Context(), principal, permission)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if denied != "" {
+			http.Error(w, denied, http.StatusForbidden)
+			return
+		}
+		next(w, r, ps)
+	})
+}
+
+// Allows reports whether principal may use permission. The user's role
+// must have been granted it; the role comes from the users table rather than
+// the token so role changes apply on the next request. With admin two-factor
+// enforcement on, admins are refused until they enroll. An API key
+// additionally needs permission among its scopes.
+func (a *Authorizer) Allows(ctx context.Context, principal *h.Principal, permission string) (bool, error) {
+	denied, err := a.denial(ctx, principal, permission)
+	return err == nil && denied == "", err
+}
+
+// denial returns why principal may not use permission, or "" if it may.
+func (a *Authorizer) denial(ctx context.Context, principal *h.Principal, permission string) (string, error) {
+	if principal.APIKey != nil && !principal.APIKey.Scopes.Has(permission) {
+		return "API key is missing the " + permission + " scope", nil
+	}
+	if a.requireAdminTwoFactor && principal.User.RoleId == m.RoleAdmin && !principal.User.TwoFactorEnabled {
+		return "Two-factor authentication is required for your role", nil
+	}
+	granted, err := a.permissions.HasPermission(ctx, principal.User.RoleId, permission)
+	if err != nil {
+		return "", err
+	}
+	if !granted {
+		return "Access denied", nil
+	}
+	return "", nil
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"final-project/config"
+	d "final-project/db"
+	"final-project/migrations"
+	"fmt"
+	"log/slog"
+	"os"
+	"text/tabwriter"
+)
+
+// runMigrate implements "migrate up|down|status".
+func runMigrate(cfg *config.Config, args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: migrate up|down|status")
+	}
+	if cfg.StorageDriver == "memory" {
+		return errors.New("the memory storage driver has no schema to migrate")
+	}
+
+	ctx := context.Background()
+	store, err := d.Open(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	switch args[0] {
+	case "up":
+		return migrateUp(ctx, store)
+	case "down":
+		migrator, err := migrations.New(store.DB, store.Driver)
+		if err != nil {
+			return err
+		}
+		reverted, err := migrator.Down(ctx)
+		if err != nil {
+			return err
+		}
+		if reverted == nil {
+			slog.Info("No migrations to revert")
+		} else {
+			slog.Info("Reverted migration", "version", reverted.Version, "name", reverted.Name)
+		}
+		return nil
+	case "status":
+		migrator, err := migrations.New(store.DB, store.Driver)
+		if err != nil {
+			return err
+		}
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		out := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(out, "VERSION\tNAME\tAPPLIED AT")
+		for _, status := range statuses {
+			appliedAt := "pending"
+			if status.AppliedAt != nil {
+				appliedAt = status.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Fprintf(out, "%04d\t%s\t%s\n", status.Version, status.Name, appliedAt)
+		}
+		return out.Flush()
+	}
+	return fmt.Errorf("unknown migrate command %q (want up, down or status)", args[0])
+}
+
+func migrateUp(ctx context.Context, store *d.Store) error {
+	migrator, err := migrations.New(store.DB, store.Driver)
+	if err != nil {
+		return err
+	}
+	applied, err := migrator.Up(ctx)
+	for _, migration := range applied {
+		slog.Info("Applied migration", "version", migration.Version, "name", migration.Name)
+	}
+	if err == nil && len(applied) == 0 {
+		slog.Info("Schema is up to date")
+	}
+	return err
+}
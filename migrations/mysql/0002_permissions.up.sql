@@ -0,0 +1,25 @@
+CREATE TABLE permissions (
+    id INT PRIMARY KEY AUTO_INCREMENT,
+    name VARCHAR(255) NOT NULL UNIQUE,
+    description VARCHAR(255) NOT NULL,
+    created_at DATETIME NOT NULL,
+    updated_at DATETIME NOT NULL
+);
+
+CREATE TABLE role_permissions (
+    role_id INT NOT NULL,
+    permission_id INT NOT NULL,
+    PRIMARY KEY (role_id, permission_id),
+    FOREIGN KEY (role_id) REFERENCES roles(id) ON DELETE CASCADE,
+    FOREIGN KEY (permission_id) REFERENCES permissions(id) ON DELETE CASCADE
+);
+
+-- Keep existing admins working until the seed command has run.
+INSERT INTO permissions (name, description, created_at, updated_at) VALUES
+    ('games:manage', 'Add, update and delete games', NOW(), NOW()),
+    ('roles:manage', 'Create, list and delete roles', NOW(), NOW()),
+    ('users:read', 'View any user''s details', NOW(), NOW()),
+    ('users:manage', 'Edit, delete and change the role of users', NOW(), NOW());
+
+INSERT INTO role_permissions (role_id, permission_id)
+    SELECT r.id, p.id FROM roles r CROSS JOIN permissions p WHERE r.id = 2;
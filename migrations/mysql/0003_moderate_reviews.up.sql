@@ -0,0 +1,5 @@
+INSERT INTO permissions (name, description, created_at, updated_at)
+    VALUES ('reviews:moderate', 'Delete any user''s review', NOW(), NOW());
+
+INSERT INTO role_permissions (role_id, permission_id)
+    SELECT r.id, p.id FROM roles r CROSS JOIN permissions p WHERE r.id = 2 AND p.name = 'reviews:moderate';
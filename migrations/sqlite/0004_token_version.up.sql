@@ -0,0 +1,3 @@
+-- Bumped when every token of the user must stop working, such as after a
+-- password change or reset; tokens carrying an older version are rejected.
+ALTER TABLE users ADD COLUMN token_version INT NOT NULL DEFAULT 0;
@@ -0,0 +1,4 @@
+-- Set once the user follows the link of the verification email. Accounts
+-- that exist before this migration are treated as verified.
+ALTER TABLE users ADD COLUMN email_verified BOOLEAN NOT NULL DEFAULT FALSE;
+UPDATE users SET email_verified = TRUE;
@@ -0,0 +1,3 @@
+ALTER TABLE users DROP COLUMN preferences;
+ALTER TABLE users DROP COLUMN bio;
+ALTER TABLE users DROP COLUMN avatar_url;
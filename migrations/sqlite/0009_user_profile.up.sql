@@ -0,0 +1,5 @@
+-- Optional profile fields; preferences holds a JSON document of display
+-- settings.
+ALTER TABLE users ADD COLUMN avatar_url VARCHAR(500) NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN bio VARCHAR(1000) NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN preferences VARCHAR(1000) NOT NULL DEFAULT '{}';
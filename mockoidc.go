@@ -0,0 +1,52 @@
+package main
+
+import (
+	"errors"
+	"final-project/config"
+	"final-project/oidc"
+	"flag"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// runMockOIDC implements "mock-oidc [-addr :9000] [-email ...] [-name ...]
+// [-unverified]": a local OpenID Connect issuer for the OIDC_* settings to
+// point at.
+func runMockOIDC(cfg *config.Config, args []string) error {
+	flags := flag.NewFlagSet("mock-oidc", flag.ContinueOnError)
+	addr := flags.String("addr", ":9000", "listen address")
+	email := flags.String("email", "mock.user@example.com", "email of the user that signs in without a login_hint")
+	name := flags.String("name", "Mock User", "name of that user")
+	unverified := flags.Bool("unverified", false, "report email addresses as not verified")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	issuer := cfg.OIDCIssuer
+	if issuer == "" {
+		host := *addr
+		if strings.HasPrefix(host, ":") {
+			host = "localhost" + host
+		}
+		issuer = "http://" + host
+	}
+	clientID := cfg.OIDCClientID
+	if clientID == "" {
+		return errors.New("set OIDC_CLIENT_ID to the client id the API uses")
+	}
+	mock, err := oidc.NewMockIssuer(issuer, clientID)
+	if err != nil {
+		return err
+	}
+	mock.ClientSecret = cfg.OIDCClientSecret
+	mock.RedirectURIs = []string{cfg.OIDCRedirectURL}
+	mock.Email = *email
+	mock.Name = *name
+	mock.EmailVerified = !*unverified
+
+	slog.Info("Mock OIDC issuer listening", "addr", *addr, "issuer", issuer, "client_id", clientID)
+	server := &http.Server{Addr: *addr, Handler: mock, ReadHeaderTimeout: 10 * time.Second}
+	return server.ListenAndServe()
+}
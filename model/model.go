@@ -2,7 +2,9 @@ package model
 
 import (
 	"database/sql/driver"
+	"encoding/json"
 	"fmt"
+	"strings"
 	"time"
 )
 
@@ -30,27 +32,79 @@ func (t MySQLTime) Value() (driver.Value, error) {
 	return t.Time.Format("2006-01-02 15:04:05"), nil
 }
 
+// Scan accepts the []byte DATETIME text the MySQL driver returns, and the
+// string or time.Time values the SQLite driver returns for DATETIME columns.
+// Value stores local wall-clock time without a zone, so it is read back in
+// time.Local for comparisons with time.Now to hold.
 func (t *MySQLTime) Scan(value interface{}) error {
 	switch v := value.(type) {
 	case []byte:
-		parseTime, err := time.Parse("2006-01-02 15:04:05", string(v))
-		if err != nil {
-			return err
-		}
-		t.Time = parseTime
-		return nil
+		return t.parse(string(v))
+	case string:
+		return t.parse(v)
 	case time.Time:
-		t.Time = v
+		t.Time = time.Date(v.Year(), v.Month(), v.Day(), v.Hour(), v.Minute(), v.Second(), v.Nanosecond(), time.Local)
 		return nil
 	default:
 		return fmt.Errorf("unsupported Scan: %T", value)
 	}
 }
 
+var mySQLTimeLayouts = []string{
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02 15:04:05.999999999-07:00",
+	time.RFC3339Nano,
+}
+
+func (t *MySQLTime) parse(value string) error {
+	var err error
+	for _, layout := range mySQLTimeLayouts {
+		var parseTime time.Time
+		if parseTime, err = time.ParseInLocation(layout, value, time.Local); err == nil {
+			t.Time = parseTime
+			return nil
+		}
+	}
+	return err
+}
+
 func NewMySQLTime(t time.Time) MySQLTime {
 	return MySQLTime{t}
 }
 
+// Built-in role ids. The seed command creates both and Register assigns
+// RoleUser to every new account.
+const (
+	RoleUser  = 1
+	RoleAdmin = 2
+)
+
+// Permission names checked by the authorization middleware.
+const (
+	PermManageGames = "games:manage"
+	PermManageRoles = "roles:manage"
+	PermViewUsers   = "users:read"
+	PermManageUsers = "users:manage"
+	// PermModerateReviews allows deleting reviews written by other users.
+	PermModerateReviews = "reviews:moderate"
+)
+
+// ScopeAccount lets an API key act as its user on routes that need no
+// permission, such as reviews, the wishlist and the profile. Every other
+// scope is a permission name.
+const ScopeAccount = "account"
+
+// Permissions is the catalog the seed command keeps in the permissions
+// table. The admin role is granted all of them.
+var Permissions = []Permission{
+	{Name: PermManageGames, Description: "Add, update and delete games"},
+	{Name: PermManageRoles, Description: "Create, list and delete roles"},
+	{Name: PermViewUsers, Description: "View any user's details"},
+	{Name: PermManageUsers, Description: "Edit, delete and change the role of users"},
+	{Name: PermModerateReviews, Description: "Delete any user's review"},
+}
+
 type Role struct {
 	ID        int       `json:"id"`
 	RoleName  string    `json:"role_name"`
@@ -58,18 +112,243 @@ type Role struct {
 	UpdatedAt MySQLTime `json:"updated_at"`
 }
 
-type User struct {
+type RolePermissionRequest struct {
+	Permission string `json:"permission"`
+}
+
+// RefreshToken is one step of a device's login. Only the SHA-256 hash of the
+// token is stored, and every rotation keeps the FamilyID of the first login.
+type RefreshToken struct {
+	ID        int       `json:"id"`
+	UserID    int       `json:"user_id"`
+	FamilyID  string    `json:"family_id"`
+	TokenHash string    `json:"-"`
+	Device    string    `json:"device"`
+	Revoked   bool      `json:"revoked"`
+	ExpiresAt MySQLTime `json:"expires_at"`
+	CreatedAt MySQLTime `json:"created_at"`
+}
+
+// Session is one login on one device. Its ID doubles as the FamilyID of the
+// login's refresh tokens and the "sid" claim of its access tokens.
+type Session struct {
+	ID         string    `json:"id"`
+	UserID     int       `json:"user_id"`
+	Device     string    `json:"device"`
+	IPAddress  string    `json:"ip_address"`
+	UserAgent  string    `json:"user_agent"`
+	Revoked    bool      `json:"-"`
+	CreatedAt  MySQLTime `json:"created_at"`
+	LastSeenAt MySQLTime `json:"last_seen_at"`
+	// Current is set by the session list for the caller's own session.
+	Current bool `json:"current"`
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// PasswordReset is a mailed one-time token for choosing a new password.
+// Only the SHA-256 hash of the token is stored.
+type PasswordReset struct {
+	ID        int       `json:"id"`
+	UserID    int       `json:"user_id"`
+	TokenHash string    `json:"-"`
+	Used      bool      `json:"used"`
+	ExpiresAt MySQLTime `json:"expires_at"`
+	CreatedAt MySQLTime `json:"created_at"`
+}
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email"`
+}
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+// APIKey is a long-lived credential for scripts, sent in the X-API-Key
+// header. Only the SHA-256 hash of the key is stored; Prefix identifies it
+// in listings.
+type APIKey struct {
+	ID         int        `json:"id"`
+	UserID     int        `json:"user_id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	KeyHash    string     `json:"-"`
+	Scopes     Scopes     `json:"scopes"`
+	Revoked    bool       `json:"-"`
+	ExpiresAt  MySQLTime  `json:"expires_at"`
+	LastUsedAt *MySQLTime `json:"last_used_at"`
+	CreatedAt  MySQLTime  `json:"created_at"`
+}
+
+type APIKeyRequest struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+	// ExpiresInDays defaults to 90.
+	ExpiresInDays int `json:"expires_in_days"`
+}
+
+// Scopes is stored as a comma-separated list.
+type Scopes []string
+
+// Has reports whether scope is in s.
+func (s Scopes) Has(scope string) bool {
+	for _, granted := range s {
+		if granted == scope {
+			return true
+		}
+	}
+	return false
+}
+
+func (s Scopes) Value() (driver.Value, error) {
+	return strings.Join(s, ","), nil
+}
+
+func (s *Scopes) Scan(value interface{}) error {
+	var list string
+	switch v := value.(type) {
+	case []byte:
+		list = string(v)
+	case string:
+		list = v
+	default:
+		return fmt.Errorf("unsupported Scan: %T", value)
+	}
+	*s = Scopes{}
+	for _, scope := range strings.Split(list, ",") {
+		if scope != "" {
+			*s = append(*s, scope)
+		}
+	}
+	return nil
+}
+
+// UserIdentity links a user to an account at an OpenID Connect provider,
+// identified by the issuer and the provider's subject.
+type UserIdentity struct {
+	ID        int       `json:"id"`
+	UserID    int       `json:"user_id"`
+	Issuer    string    `json:"issuer"`
+	Subject   string    `json:"subject"`
+	Email     string    `json:"email"`
+	CreatedAt MySQLTime `json:"created_at"`
+}
+
+// RecoveryCode is one single-use code that replaces a TOTP code when the
+// authenticator is lost. Only its SHA-256 hash is stored.
+type RecoveryCode struct {
+	ID        int       `json:"id"`
+	UserID    int       `json:"user_id"`
+	CodeHash  string    `json:"-"`
+	Used      bool      `json:"used"`
+	CreatedAt MySQLTime `json:"created_at"`
+}
+
+type TwoFactorCodeRequest struct {
+	Code string `json:"code"`
+}
+
+type TwoFactorDisableRequest struct {
+	Password string `json:"password"`
+	Code     string `json:"code"`
+}
+
+// TwoFactorLoginRequest is the second login step. Code is a TOTP code or a
+// recovery code.
+type TwoFactorLoginRequest struct {
+	ChallengeToken string `json:"challenge_token"`
+	Code           string `json:"code"`
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+type RegisterRequest struct {
+	Name     string `json:"name"`
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+type LoginRequest struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+// UpdateUserRequest only changes the name; Password is accepted to point
+// the client to ChangePassword instead of silently ignoring it.
+type UpdateUserRequest struct {
+	Name     string `json:"name"`
+	Password string `json:"password,omitempty"`
+}
+
+// DeleteAccountRequest confirms the deletion of the caller's account. Code
+// is required when two-factor authentication is enabled.
+type DeleteAccountRequest struct {
+	Password string `json:"password"`
+	Code     string `json:"code"`
+}
+
+// AccountExport is everything stored about a user that they can take with
+// them before deleting the account.
+type AccountExport struct {
+	ExportedAt MySQLTime               `json:"exported_at"`
+	User       SelfUser                `json:"user"`
+	Reviews    []Review                `json:"reviews"`
+	Wishlist   []WishlistWithGameTitle `json:"wishlist"`
+}
+
+type UserRoleRequest struct {
+	RoleID int `json:"role_id"`
+}
+
+type ResendVerificationRequest struct {
+	Email string `json:"email"`
+}
+
+type Permission struct {
 	ID          int       `json:"id"`
-	Email       string    `json:"email"`
 	Name        string    `json:"name"`
-	Password    string    `json:"password"`
-	RoleId      int       `json:"role_id"`
-	AccessToken string    `json:"access_token"`
-	Active      bool      `json:"active"`
+	Description string    `json:"description"`
 	CreatedAt   MySQLTime `json:"created_at"`
 	UpdatedAt   MySQLTime `json:"updated_at"`
 }
 
+// User is the stored account. Password is the bcrypt hash and AccessToken
+// the last issued token; neither is ever serialized. Responses use
+// PublicUser, SelfUser or AdminUser.
+type User struct {
+	ID          int             `json:"id"`
+	Email       string          `json:"email"`
+	Name        string          `json:"name"`
+	Password    string          `json:"-"`
+	RoleId      int             `json:"role_id"`
+	AccessToken string          `json:"-"`
+	Active      bool            `json:"active"`
+	AvatarURL   string          `json:"avatar_url"`
+	Bio         string          `json:"bio"`
+	Preferences UserPreferences `json:"preferences"`
+	// EmailVerified is set once the user opens the link of the verification
+	// email.
+	EmailVerified bool `json:"email_verified"`
+	// TwoFactorEnabled is set once the user confirmed a TOTPSecret with a
+	// code; until then the secret is only pending enrollment.
+	TwoFactorEnabled bool   `json:"two_factor_enabled"`
+	TOTPSecret       string `json:"-"`
+	// TOTPLastStep is the time step of the last accepted code, so a code
+	// cannot be replayed.
+	TOTPLastStep int64 `json:"-"`
+	// TokenVersion must match the "ver" claim for a token to be accepted.
+	TokenVersion int       `json:"-"`
+	CreatedAt    MySQLTime `json:"created_at"`
+	UpdatedAt    MySQLTime `json:"updated_at"`
+}
+
 type Game struct {
 	ID          int       `json:"id"`
 	Title       string    `json:"title"`
@@ -80,9 +359,16 @@ type Game struct {
 	UpdatedAt   MySQLTime `json:"updated_at"`
 }
 
+// DeletedUserName is the author of reviews kept after their writer deleted
+// the account.
+const DeletedUserName = "deleted user"
+
+// Review is a user's rating of a game. UserID is 0 once the writer deleted
+// the account, and Author is then DeletedUserName.
 type Review struct {
 	ID          int       `json:"id"`
 	UserID      int       `json:"user_id"`
+	Author      string    `json:"author,omitempty"`
 	GameID      int       `json:"game_id"`
 	Rating      int       `json:"rating"`
 	Description string    `json:"description"`
@@ -98,9 +384,113 @@ type Wishlist struct {
 	UpdatedAt MySQLTime `json:"updated_at"`
 }
 
-type UserResponse struct {
-	Name   string `json:"name"`
-	RoleId int    `json:"role_id"`
+// UserPreferences are display settings applied by the client. They are
+// stored as a JSON document in users.preferences.
+type UserPreferences struct {
+	Theme    string `json:"theme,omitempty"`
+	Language string `json:"language,omitempty"`
+	Timezone string `json:"timezone,omitempty"`
+}
+
+func (p UserPreferences) Value() (driver.Value, error) {
+	data, err := json.Marshal(p)
+	return string(data), err
+}
+
+func (p *UserPreferences) Scan(value interface{}) error {
+	var data []byte
+	switch v := value.(type) {
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	case nil:
+		*p = UserPreferences{}
+		return nil
+	default:
+		return fmt.Errorf("unsupported Scan: %T", value)
+	}
+	if len(data) == 0 {
+		*p = UserPreferences{}
+		return nil
+	}
+	return json.Unmarshal(data, p)
+}
+
+// UserProfilePatch is the body of a profile PATCH. Nil fields are left
+// unchanged; an empty string clears avatar_url, bio or a preference.
+type UserProfilePatch struct {
+	Name        *string           `json:"name"`
+	AvatarURL   *string           `json:"avatar_url"`
+	Bio         *string           `json:"bio"`
+	Preferences *PreferencesPatch `json:"preferences"`
+}
+
+type PreferencesPatch struct {
+	Theme    *string `json:"theme"`
+	Language *string `json:"language"`
+	Timezone *string `json:"timezone"`
+}
+
+// PublicUser is what any signed-in user may see of another user.
+type PublicUser struct {
+	ID        int    `json:"id"`
+	Name      string `json:"name"`
+	AvatarURL string `json:"avatar_url"`
+	Bio       string `json:"bio"`
+	RoleId    int    `json:"role_id"`
+}
+
+func NewPublicUser(user User) PublicUser {
+	return PublicUser{
+		ID:        user.ID,
+		Name:      user.Name,
+		AvatarURL: user.AvatarURL,
+		Bio:       user.Bio,
+		RoleId:    user.RoleId,
+	}
+}
+
+// SelfUser is the caller's own account, without credentials or tokens.
+type SelfUser struct {
+	ID            int             `json:"id"`
+	Email         string          `json:"email"`
+	Name          string          `json:"name"`
+	AvatarURL     string          `json:"avatar_url"`
+	Bio           string          `json:"bio"`
+	Preferences   UserPreferences `json:"preferences"`
+	RoleId        int             `json:"role_id"`
+	EmailVerified bool            `json:"email_verified"`
+	TwoFactor     bool            `json:"two_factor_enabled"`
+	CreatedAt     MySQLTime       `json:"created_at"`
+	UpdatedAt     MySQLTime       `json:"updated_at"`
+}
+
+func NewSelfUser(user User) SelfUser {
+	return SelfUser{
+		ID:            user.ID,
+		Email:         user.Email,
+		Name:          user.Name,
+		AvatarURL:     user.AvatarURL,
+		Bio:           user.Bio,
+		Preferences:   user.Preferences,
+		RoleId:        user.RoleId,
+		EmailVerified: user.EmailVerified,
+		TwoFactor:     user.TwoFactorEnabled,
+		CreatedAt:     user.CreatedAt,
+		UpdatedAt:     user.UpdatedAt,
+	}
+}
+
+// AdminUser is a user as seen by user managers: SelfUser and whether the
+// user has a session that is not revoked.
+type AdminUser struct {
+	SelfUser
+	Active bool `json:"active"`
+}
+
+func NewAdminUser(user User, active bool) AdminUser {
+	return AdminUser{SelfUser: NewSelfUser(user), Active: active}
 }
 
 type GameResponse struct {
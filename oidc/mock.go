@@ -0,0 +1,272 @@
+package oidc
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// mockCodeTTL is how long an authorization code of the mock issuer works.
+const mockCodeTTL = time.Minute
+
+// MockIssuer is a minimal OpenID Connect provider for local development
+// and tests. Its login page signs in at once as the address in the
+// login_hint parameter, or as Email when there is none. It implements the
+// authorization code flow with PKCE (S256) and nothing else.
+type MockIssuer struct {
+	// Issuer is the URL the mock is served under, without a trailing slash.
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	// RedirectURIs restricts redirect_uri when not empty.
+	RedirectURIs []string
+
+	Email         string
+	Name          string
+	EmailVerified bool
+
+	key *rsa.PrivateKey
+	kid string
+
+	mu    sync.Mutex
+	codes map[string]mockCode
+}
+
+type mockCode struct {
+	clientID    string
+	redirectURI string
+	challenge   string
+	nonce       string
+	email       string
+	expiresAt   time.Time
+}
+
+// NewMockIssuer returns a mock issuer with a fresh RSA signing key and a
+// default identity with a verified email.
+func NewMockIssuer(issuer, clientID string) (*MockIssuer, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+	kid, err := randomString(8)
+	if err != nil {
+		return nil, err
+	}
+	return &MockIssuer{
+		Issuer:        strings.TrimSuffix(issuer, "/"),
+		ClientID:      clientID,
+		Email:         "mock.user@example.com",
+		Name:          "Mock User",
+		EmailVerified: true,
+		key:           key,
+		kid:           kid,
+		codes:         make(map[string]mockCode),
+	}, nil
+}
+
+func (mi *MockIssuer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/.well-known/openid-configuration":
+		mi.writeJSON(w, http.StatusOK, map[string]interface{}{
+			"issuer":                                mi.Issuer,
+			"authorization_endpoint":                mi.Issuer + "/authorize",
+			"token_endpoint":                        mi.Issuer + "/token",
+			"jwks_uri":                              mi.Issuer + "/jwks",
+			"response_types_supported":              []string{"code"},
+			"subject_types_supported":               []string{"public"},
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+			"code_challenge_methods_supported":      []string{"S256"},
+			"grant_types_supported":                 []string{"authorization_code"},
+		})
+	case "/jwks":
+		mi.writeJSON(w, http.StatusOK, map[string]interface{}{
+			"keys": []jwk{{
+				Kty: "RSA",
+				Kid: mi.kid,
+				Use: "sig",
+				Alg: "RS256",
+				N:   base64.RawURLEncoding.EncodeToString(mi.key.N.Bytes()),
+				E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(mi.key.E)).Bytes()),
+			}},
+		})
+	case "/authorize":
+		mi.authorize(w, r)
+	case "/token":
+		mi.token(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// authorize approves every valid request and redirects back with a code.
+func (mi *MockIssuer) authorize(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	redirectURI := query.Get("redirect_uri")
+	if query.Get("client_id") != mi.ClientID {
+		http.Error(w, "unknown client_id", http.StatusBadRequest)
+		return
+	}
+	if redirectURI == "" || (len(mi.RedirectURIs) > 0 && !slices.Contains(mi.RedirectURIs, redirectURI)) {
+		http.Error(w, "redirect_uri is not registered", http.StatusBadRequest)
+		return
+	}
+	target, err := url.Parse(redirectURI)
+	if err != nil {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+
+	// From here on errors go back to the client (RFC 6749 section 4.1.2.1).
+	back := target.Query()
+	back.Set("state", query.Get("state"))
+	fail := func(code string) {
+		back.Set("error", code)
+		target.RawQuery = back.Encode()
+		http.Redirect(w, r, target.String(), http.StatusFound)
+	}
+	if query.Get("response_type") != "code" {
+		fail("unsupported_response_type")
+		return
+	}
+	if !strings.Contains(" "+query.Get("scope")+" ", " openid ") {
+		fail("invalid_scope")
+		return
+	}
+	if query.Get("code_challenge") == "" || query.Get("code_challenge_method") != "S256" {
+		fail("invalid_request")
+		return
+	}
+
+	email := query.Get("login_hint")
+	if email == "" {
+		email = mi.Email
+	}
+	code, err := randomString(32)
+	if err != nil {
+		fail("server_error")
+		return
+	}
+	mi.mu.Lock()
+	mi.codes[code] = mockCode{
+		clientID:    mi.ClientID,
+		redirectURI: redirectURI,
+		challenge:   query.Get("code_challenge"),
+		nonce:       query.Get("nonce"),
+		email:       email,
+		expiresAt:   time.Now().Add(mockCodeTTL),
+	}
+	mi.mu.Unlock()
+
+	back.Set("code", code)
+	target.RawQuery = back.Encode()
+	http.Redirect(w, r, target.String(), http.StatusFound)
+}
+
+// token redeems a code once, checking the client, redirect_uri and PKCE
+// verifier it was issued for.
+func (mi *MockIssuer) token(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		mi.tokenError(w, http.StatusBadRequest, "invalid_request")
+		return
+	}
+	clientID, clientSecret, basic := r.BasicAuth()
+	if basic {
+		clientID, _ = url.QueryUnescape(clientID)
+		clientSecret, _ = url.QueryUnescape(clientSecret)
+	} else {
+		clientID, clientSecret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+	if clientID != mi.ClientID || subtle.ConstantTimeCompare([]byte(clientSecret), []byte(mi.ClientSecret)) != 1 {
+		mi.tokenError(w, http.StatusUnauthorized, "invalid_client")
+		return
+	}
+	if r.PostForm.Get("grant_type") != "authorization_code" {
+		mi.tokenError(w, http.StatusBadRequest, "unsupported_grant_type")
+		return
+	}
+
+	mi.mu.Lock()
+	code, ok := mi.codes[r.PostForm.Get("code")]
+	delete(mi.codes, r.PostForm.Get("code"))
+	mi.mu.Unlock()
+	if !ok || time.Now().After(code.expiresAt) || code.clientID != clientID ||
+		code.redirectURI != r.PostForm.Get("redirect_uri") ||
+		Challenge(r.PostForm.Get("code_verifier")) != code.challenge {
+		mi.tokenError(w, http.StatusBadRequest, "invalid_grant")
+		return
+	}
+
+	now := time.Now()
+	// The subject only has to be stable per address.
+	sum := sha256.Sum256([]byte(strings.ToLower(code.email)))
+	claims := idTokenClaims{
+		Nonce:         code.nonce,
+		Email:         code.email,
+		EmailVerified: mi.EmailVerified,
+		Name:          mi.name(code.email),
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    mi.Issuer,
+			Subject:   hex.EncodeToString(sum[:16]),
+			Audience:  jwt.ClaimStrings{clientID},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(5 * time.Minute)),
+		},
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = mi.kid
+	idToken, err := token.SignedString(mi.key)
+	if err != nil {
+		mi.tokenError(w, http.StatusInternalServerError, "server_error")
+		return
+	}
+	accessToken, err := randomString(32)
+	if err != nil {
+		mi.tokenError(w, http.StatusInternalServerError, "server_error")
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	mi.writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": accessToken,
+		"token_type":   "Bearer",
+		"expires_in":   300,
+		"id_token":     idToken,
+	})
+}
+
+// name is Name for the default identity and the local part of other
+// addresses.
+func (mi *MockIssuer) name(email string) string {
+	if email == mi.Email {
+		return mi.Name
+	}
+	local, _, _ := strings.Cut(email, "@")
+	return local
+}
+
+func (mi *MockIssuer) tokenError(w http.ResponseWriter, status int, code string) {
+	mi.writeJSON(w, status, map[string]string{"error": code})
+}
+
+func (mi *MockIssuer) writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"final-project/oidc"
+)
+
+// oidcTest is a test server that logs in with a mock issuer.
+type oidcTest struct {
+	*testServer
+	issuer *oidc.MockIssuer
+}
+
+func newOIDCTest(t *testing.T) *oidcTest {
+	t.Helper()
+	var issuer *oidc.MockIssuer
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		issuer.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+	issuer, err := oidc.NewMockIssuer(server.URL, "test-client")
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuer.ClientSecret = "test-secret"
+	s := newTestServer(t, map[string]string{
+		"OIDC_ISSUER":        server.URL,
+		"OIDC_CLIENT_ID":     issuer.ClientID,
+		"OIDC_CLIENT_SECRET": issuer.ClientSecret,
+	})
+	return &oidcTest{testServer: s, issuer: issuer}
+}
+
+// login runs the browser side of an OIDC login as loginHint. tamper may
+// change the request to the issuer's login page and then the callback.
+func (o *oidcTest) login(loginHint string, tamper func(authorize, callback url.Values)) *httptest.ResponseRecorder {
+	o.t.Helper()
+	w := o.do("GET", "/user/oidc/login?login_hint="+url.QueryEscape(loginHint), nil, nil)
+	if w.Code != http.StatusFound {
+		o.t.Fatalf("GET /user/oidc/login = %d, want 302", w.Code)
+	}
+	cookies := w.Result().Cookies()
+
+	authorize, err := url.Parse(w.Header().Get("Location"))
+	if err != nil {
+		o.t.Fatal(err)
+	}
+	authorizeQuery := authorize.Query()
+	if tamper != nil {
+		tamper(authorizeQuery, nil)
+	}
+	authorize.RawQuery = authorizeQuery.Encode()
+	r := httptest.NewRequest("GET", authorize.String(), nil)
+	issued := httptest.NewRecorder()
+	o.issuer.ServeHTTP(issued, r)
+	callback, err := url.Parse(issued.Header().Get("Location"))
+	if err != nil || issued.Code != http.StatusFound {
+		o.t.Fatalf("issuer authorize = %d %q, want a redirect", issued.Code, issued.Header().Get("Location"))
+	}
+	callbackQuery := callback.Query()
+	if tamper != nil {
+		tamper(nil, callbackQuery)
+	}
+
+	r = httptest.NewRequest("GET", "/user/oidc/callback?"+callbackQuery.Encode(), nil)
+	for _, cookie := range cookies {
+		r.AddCookie(cookie)
+	}
+	w = httptest.NewRecorder()
+	o.handler.ServeHTTP(w, r)
+	return w
+}
+
+func TestOIDCLogin(t *testing.T) {
+	o := newOIDCTest(t)
+	w := o.login("new.user@example.com", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET /user/oidc/callback = %d %q, want 200", w.Code, w.Body.String())
+	}
+	var response struct {
+		AccessToken string `json:"access_token"`
+		User        struct {
+			Email string `json:"email"`
+		} `json:"user"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	if response.User.Email != "new.user@example.com" {
+		t.Errorf("logged in as %q, want the user created for the identity", response.User.Email)
+	}
+	o.expect(http.StatusOK, "GET", "/user", bearer(response.AccessToken), nil)
+
+	// The second login finds the linked identity.
+	if w := o.login("new.user@example.com", nil); w.Code != http.StatusOK {
+		t.Errorf("second login: GET /user/oidc/callback = %d %q, want 200", w.Code, w.Body.String())
+	}
+}
+
+func TestOIDCLoginRefused(t *testing.T) {
+	tests := []struct {
+		name   string
+		email  string
+		tamper func(authorize, callback url.Values)
+		want   int
+	}{
+		{
+			name:  "wrong nonce",
+			email: "new.user@example.com",
+			tamper: func(authorize, _ url.Values) {
+				if authorize != nil {
+					authorize.Set("nonce", "forged")
+				}
+			},
+			want: http.StatusUnauthorized,
+		},
+		{
+			name:  "bad state",
+			email: "new.user@example.com",
+			tamper: func(_, callback url.Values) {
+				if callback != nil {
+					callback.Set("state", "forged")
+				}
+			},
+			want: http.StatusBadRequest,
+		},
+		{
+			name:  "unverified local account with the same email",
+			email: "user@example.com",
+			want:  http.StatusConflict,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := newOIDCTest(t)
+			o.register("user@example.com")
+			if w := o.login(tt.email, tt.tamper); w.Code != tt.want {
+				t.Errorf("GET /user/oidc/callback = %d %q, want %d", w.Code, w.Body.String(), tt.want)
+			}
+			if _, err := o.repos.Users.GetByEmail(context.Background(), "new.user@example.com"); err == nil {
+				t.Error("a refused login created a user")
+			}
+		})
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	m "final-project/model"
+)
+
+func TestPasswordResetSingleUse(t *testing.T) {
+	s := newTestServer(t, map[string]string{"PASSWORD_RESET_URL": "https://app.example.com/reset"})
+	s.register("user@example.com")
+	session := s.login("user@example.com", testPassword)
+
+	s.expect(http.StatusOK, "POST", "/user/password/forgot", nil, m.ForgotPasswordRequest{Email: "user@example.com"})
+	link := s.mailedLink("user@example.com")
+	if link.Host != "app.example.com" {
+		t.Errorf("reset link = %s, want a link to PASSWORD_RESET_URL", link)
+	}
+	token := link.Query().Get("token")
+
+	// A password the policy rejects leaves the token for another try.
+	s.expect(http.StatusBadRequest, "POST", "/user/password/reset", nil, m.ResetPasswordRequest{Token: token, Password: "short"})
+	s.expect(http.StatusOK, "POST", "/user/password/reset", nil, m.ResetPasswordRequest{Token: token, Password: otherPassword})
+	s.expect(http.StatusBadRequest, "POST", "/user/password/reset", nil, m.ResetPasswordRequest{Token: token, Password: testPassword})
+	s.expect(http.StatusUnauthorized, "GET", "/user", bearer(session.access), nil)
+	s.expect(http.StatusUnauthorized, "POST", "/user/login", nil, credentials("user@example.com", testPassword))
+	s.login("user@example.com", otherPassword)
+}
+
+func TestChangePassword(t *testing.T) {
+	tests := []struct {
+		name    string
+		current string
+		new     string
+		want    int
+	}{
+		{"wrong current password", otherPassword, "Fresh-Password-99", http.StatusForbidden},
+		{"too short", testPassword, "Sh-0rt", http.StatusBadRequest},
+		{"missing a symbol", testPassword, "FreshPassword99", http.StatusBadRequest},
+		{"common password", testPassword, "Password1!", http.StatusBadRequest},
+		{"unchanged", testPassword, testPassword, http.StatusBadRequest},
+		{"valid", testPassword, "Fresh-Password-99", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, map[string]string{"PASSWORD_REQUIRE_SYMBOL": "true"})
+			s.register("user@example.com")
+			session := s.login("user@example.com", testPassword)
+
+			request := m.ChangePasswordRequest{CurrentPassword: tt.current, NewPassword: tt.new}
+			if w := s.do("POST", "/user/password", bearer(session.access), request); w.Code != tt.want {
+				t.Errorf("POST /user/password = %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,1016 @@
+package repository
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	m "final-project/model"
+)
+
+// NewMemory returns repositories that keep everything in process memory.
+// They enforce the same unique keys as sql.txt (users.email,
+// roles.role_name, wishlists.game_id, refresh_tokens.token_hash,
+// password_resets.token_hash, api_keys.key_hash, user_identities issuer and
+// subject) but not foreign keys.
+func NewMemory() *Repositories {
+	s := &memoryStore{
+		users:           make(map[int]m.User),
+		roles:           make(map[int]m.Role),
+		permissions:     make(map[int]m.Permission),
+		rolePermissions: make(map[int]map[int]bool),
+		refreshTokens:   make(map[int]m.RefreshToken),
+		sessions:        make(map[string]m.Session),
+		passwordResets:  make(map[int]m.PasswordReset),
+		recoveryCodes:   make(map[int]m.RecoveryCode),
+		apiKeys:         make(map[int]m.APIKey),
+		identities:      make(map[int]m.UserIdentity),
+		games:           make(map[int]m.Game),
+		reviews:         make(map[int]m.Review),
+		wishlists:       make(map[int]m.Wishlist),
+		nextID:          make(map[string]int),
+	}
+	return &Repositories{
+		Users:          &memoryUserRepository{s},
+		Roles:          &memoryRoleRepository{s},
+		Permissions:    &memoryPermissionRepository{s},
+		RefreshTokens:  &memoryRefreshTokenRepository{s},
+		Sessions:       &memorySessionRepository{s},
+		PasswordResets: &memoryPasswordResetRepository{s},
+		RecoveryCodes:  &memoryRecoveryCodeRepository{s},
+		APIKeys:        &memoryAPIKeyRepository{s},
+		Identities:     &memoryIdentityRepository{s},
+		Games:          &memoryGameRepository{s},
+		Reviews:        &memoryReviewRepository{s},
+		Wishlists:      &memoryWishlistRepository{s},
+	}
+}
+
+// memoryStore is shared by all memory repositories so joins such as the
+// wishlist game title see a consistent view under one lock.
+type memoryStore struct {
+	mu          sync.RWMutex
+	users       map[int]m.User
+	roles       map[int]m.Role
+	permissions map[int]m.Permission
+	// rolePermissions maps role id to the set of granted permission ids.
+	rolePermissions map[int]map[int]bool
+	refreshTokens   map[int]m.RefreshToken
+	// sessions are keyed by their random string id.
+	sessions       map[string]m.Session
+	passwordResets map[int]m.PasswordReset
+	recoveryCodes  map[int]m.RecoveryCode
+	apiKeys        map[int]m.APIKey
+	identities     map[int]m.UserIdentity
+	games          map[int]m.Game
+	reviews        map[int]m.Review
+	wishlists      map[int]m.Wishlist
+	nextID         map[string]int
+}
+
+// id returns the next AUTO_INCREMENT value for table, or requested when it
+// is set explicitly. Callers must hold the write lock.
+func (s *memoryStore) id(table string, requested int) int {
+	if requested > 0 {
+		if requested > s.nextID[table] {
+			s.nextID[table] = requested
+		}
+		return requested
+	}
+	s.nextID[table]++
+	return s.nextID[table]
+}
+
+// sortedValues returns the map values ordered by primary key, matching the
+// insertion order a SELECT without ORDER BY usually yields.
+func sortedValues[T any](rows map[int]T) []T {
+	ids := make([]int, 0, len(rows))
+	for id := range rows {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	values := make([]T, 0, len(ids))
+	for _, id := range ids {
+		values = append(values, rows[id])
+	}
+	return values
+}
+
+// Users
+
+type memoryUserRepository struct {
+	s *memoryStore
+}
+
+func (r *memoryUserRepository) Create(_ context.Context, user *m.User) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	for _, existing := range r.s.users {
+		if existing.Email == user.Email {
+			return ErrDuplicate
+		}
+	}
+	user.ID = r.s.id("users", user.ID)
+	r.s.users[user.ID] = *user
+	return nil
+}
+
+func (r *memoryUserRepository) GetByID(_ context.Context, id int) (m.User, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+	user, ok := r.s.users[id]
+	if !ok {
+		return m.User{}, ErrNotFound
+	}
+	return user, nil
+}
+
+func (r *memoryUserRepository) GetByEmail(_ context.Context, email string) (m.User, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+	for _, user := range r.s.users {
+		if user.Email == email {
+			return user, nil
+		}
+	}
+	return m.User{}, ErrNotFound
+}
+
+func (r *memoryUserRepository) List(_ context.Context) ([]m.User, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+	return sortedValues(r.s.users), nil
+}
+
+func (r *memoryUserRepository) CountWithPermission(_ context.Context, name string) (int, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+	count := 0
+	for _, user := range r.s.users {
+		for id := range r.s.rolePermissions[user.RoleId] {
+			if r.s.permissions[id].Name == name {
+				count++
+				break
+			}
+		}
+	}
+	return count, nil
+}
+
+func (r *memoryUserRepository) CountByRole(_ context.Context, roleID int) (int, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+	count := 0
+	for _, user := range r.s.users {
+		if user.RoleId == roleID {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (r *memoryUserRepository) UpdateProfile(_ context.Context, user m.User) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	existing, ok := r.s.users[user.ID]
+	if !ok {
+		return ErrNotFound
+	}
+	existing.Name = user.Name
+	existing.AvatarURL = user.AvatarURL
+	existing.Bio = user.Bio
+	existing.Preferences = user.Preferences
+	existing.UpdatedAt = user.UpdatedAt
+	r.s.users[user.ID] = existing
+	return nil
+}
+
+func (r *memoryUserRepository) UpdatePassword(_ context.Context, id int, hash string, updatedAt m.MySQLTime) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	existing, ok := r.s.users[id]
+	if !ok {
+		return ErrNotFound
+	}
+	existing.Password = hash
+	existing.UpdatedAt = updatedAt
+	r.s.users[id] = existing
+	return nil
+}
+
+func (r *memoryUserRepository) UpdateRole(_ context.Context, user m.User) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	existing, ok := r.s.users[user.ID]
+	if !ok {
+		return ErrNotFound
+	}
+	existing.RoleId = user.RoleId
+	existing.UpdatedAt = user.UpdatedAt
+	r.s.users[user.ID] = existing
+	return nil
+}
+
+func (r *memoryUserRepository) MarkEmailVerified(_ context.Context, id int) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	existing, ok := r.s.users[id]
+	if !ok {
+		return ErrNotFound
+	}
+	existing.EmailVerified = true
+	r.s.users[id] = existing
+	return nil
+}
+
+func (r *memoryUserRepository) UpdateTwoFactor(_ context.Context, user m.User) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	existing, ok := r.s.users[user.ID]
+	if !ok {
+		return ErrNotFound
+	}
+	existing.TOTPSecret = user.TOTPSecret
+	existing.TwoFactorEnabled = user.TwoFactorEnabled
+	existing.TOTPLastStep = 0
+	r.s.users[user.ID] = existing
+	return nil
+}
+
+func (r *memoryUserRepository) UseTOTPStep(_ context.Context, id int, step int64) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	existing, ok := r.s.users[id]
+	if !ok || existing.TOTPLastStep >= step {
+		return ErrNotFound
+	}
+	existing.TOTPLastStep = step
+	r.s.users[id] = existing
+	return nil
+}
+
+func (r *memoryUserRepository) RevokeTokens(_ context.Context, id int) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	existing, ok := r.s.users[id]
+	if !ok {
+		return ErrNotFound
+	}
+	existing.TokenVersion++
+	r.s.users[id] = existing
+	return nil
+}
+
+func (r *memoryUserRepository) Delete(_ context.Context, id int, anonymizeReviews bool) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	if _, ok := r.s.users[id]; !ok {
+		return ErrNotFound
+	}
+	delete(r.s.users, id)
+
+	for reviewID, review := range r.s.reviews {
+		if review.UserID != id {
+			continue
+		}
+		if anonymizeReviews {
+			review.UserID = 0
+			review.Author = m.DeletedUserName
+			r.s.reviews[reviewID] = review
+		} else {
+			delete(r.s.reviews, reviewID)
+		}
+	}
+	// What the SQL schema removes with ON DELETE CASCADE.
+	deleteWhere(r.s.wishlists, func(wish m.Wishlist) bool { return wish.UserID == id })
+	deleteWhere(r.s.refreshTokens, func(token m.RefreshToken) bool { return token.UserID == id })
+	deleteWhere(r.s.sessions, func(session m.Session) bool { return session.UserID == id })
+	deleteWhere(r.s.passwordResets, func(reset m.PasswordReset) bool { return reset.UserID == id })
+	deleteWhere(r.s.recoveryCodes, func(code m.RecoveryCode) bool { return code.UserID == id })
+	deleteWhere(r.s.apiKeys, func(key m.APIKey) bool { return key.UserID == id })
+	deleteWhere(r.s.identities, func(identity m.UserIdentity) bool { return identity.UserID == id })
+	return nil
+}
+
+// deleteWhere removes the values of table that match.
+func deleteWhere[K comparable, V any](table map[K]V, match func(V) bool) {
+	for key, value := range table {
+		if match(value) {
+			delete(table, key)
+		}
+	}
+}
+
+// Roles
+
+type memoryRoleRepository struct {
+	s *memoryStore
+}
+
+func (r *memoryRoleRepository) Create(_ context.Context, role *m.Role) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	for _, existing := range r.s.roles {
+		if existing.RoleName == role.RoleName || existing.ID == role.ID {
+			return ErrDuplicate
+		}
+	}
+	role.ID = r.s.id("roles", role.ID)
+	r.s.roles[role.ID] = *role
+	return nil
+}
+
+func (r *memoryRoleRepository) GetByID(_ context.Context, id int) (m.Role, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+	role, ok := r.s.roles[id]
+	if !ok {
+		return m.Role{}, ErrNotFound
+	}
+	return role, nil
+}
+
+func (r *memoryRoleRepository) GetByName(_ context.Context, name string) (m.Role, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+	for _, role := range r.s.roles {
+		if role.RoleName == name {
+			return role, nil
+		}
+	}
+	return m.Role{}, ErrNotFound
+}
+
+func (r *memoryRoleRepository) List(_ context.Context) ([]m.Role, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+	return sortedValues(r.s.roles), nil
+}
+
+func (r *memoryRoleRepository) Update(_ context.Context, role m.Role) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	existing, ok := r.s.roles[role.ID]
+	if !ok {
+		return ErrNotFound
+	}
+	for _, other := range r.s.roles {
+		if other.RoleName == role.RoleName && other.ID != role.ID {
+			return ErrDuplicate
+		}
+	}
+	existing.RoleName = role.RoleName
+	existing.UpdatedAt = role.UpdatedAt
+	r.s.roles[role.ID] = existing
+	return nil
+}
+
+func (r *memoryRoleRepository) Delete(_ context.Context, id int) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	if _, ok := r.s.roles[id]; !ok {
+		return ErrNotFound
+	}
+	delete(r.s.roles, id)
+	delete(r.s.rolePermissions, id)
+	return nil
+}
+
+// Permissions
+
+type memoryPermissionRepository struct {
+	s *memoryStore
+}
+
+func (r *memoryPermissionRepository) Create(_ context.Context, permission *m.Permission) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	for _, existing := range r.s.permissions {
+		if existing.Name == permission.Name {
+			return ErrDuplicate
+		}
+	}
+	permission.ID = r.s.id("permissions", permission.ID)
+	r.s.permissions[permission.ID] = *permission
+	return nil
+}
+
+func (r *memoryPermissionRepository) GetByName(_ context.Context, name string) (m.Permission, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+	for _, permission := range r.s.permissions {
+		if permission.Name == name {
+			return permission, nil
+		}
+	}
+	return m.Permission{}, ErrNotFound
+}
+
+func sortPermissions(permissions []m.Permission) []m.Permission {
+	sort.Slice(permissions, func(i, j int) bool { return permissions[i].Name < permissions[j].Name })
+	return permissions
+}
+
+func (r *memoryPermissionRepository) List(_ context.Context) ([]m.Permission, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+	return sortPermissions(sortedValues(r.s.permissions)), nil
+}
+
+func (r *memoryPermissionRepository) ListByRole(_ context.Context, roleID int) ([]m.Permission, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+	var permissions []m.Permission
+	for id := range r.s.rolePermissions[roleID] {
+		permissions = append(permissions, r.s.permissions[id])
+	}
+	return sortPermissions(permissions), nil
+}
+
+func (r *memoryPermissionRepository) HasPermission(_ context.Context, roleID int, name string) (bool, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+	for id := range r.s.rolePermissions[roleID] {
+		if r.s.permissions[id].Name == name {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (r *memoryPermissionRepository) Grant(_ context.Context, roleID, permissionID int) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	if r.s.rolePermissions[roleID][permissionID] {
+		return ErrDuplicate
+	}
+	if r.s.rolePermissions[roleID] == nil {
+		r.s.rolePermissions[roleID] = make(map[int]bool)
+	}
+	r.s.rolePermissions[roleID][permissionID] = true
+	return nil
+}
+
+func (r *memoryPermissionRepository) Revoke(_ context.Context, roleID, permissionID int) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	if !r.s.rolePermissions[roleID][permissionID] {
+		return ErrNotFound
+	}
+	delete(r.s.rolePermissions[roleID], permissionID)
+	return nil
+}
+
+// Games
+
+type memoryGameRepository struct {
+	s *memoryStore
+}
+
+func (r *memoryGameRepository) Create(_ context.Context, game *m.Game) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	game.ID = r.s.id("games", game.ID)
+	r.s.games[game.ID] = *game
+	return nil
+}
+
+func (r *memoryGameRepository) GetByID(_ context.Context, id int) (m.Game, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+	game, ok := r.s.games[id]
+	if !ok {
+		return m.Game{}, ErrNotFound
+	}
+	return game, nil
+}
+
+func (r *memoryGameRepository) List(_ context.Context) ([]m.Game, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+	return sortedValues(r.s.games), nil
+}
+
+func (r *memoryGameRepository) Update(_ context.Context, game m.Game) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	existing, ok := r.s.games[game.ID]
+	if !ok {
+		return ErrNotFound
+	}
+	game.CreatedAt = existing.CreatedAt
+	r.s.games[game.ID] = game
+	return nil
+}
+
+func (r *memoryGameRepository) Delete(_ context.Context, id int) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	if _, ok := r.s.games[id]; !ok {
+		return ErrNotFound
+	}
+	delete(r.s.games, id)
+	return nil
+}
+
+func (r *memoryGameRepository) Exists(_ context.Context, id int) (bool, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+	_, ok := r.s.games[id]
+	return ok, nil
+}
+
+// Reviews
+
+type memoryReviewRepository struct {
+	s *memoryStore
+}
+
+func (r *memoryReviewRepository) Create(_ context.Context, review *m.Review) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	review.ID = r.s.id("reviews", review.ID)
+	r.s.reviews[review.ID] = *review
+	return nil
+}
+
+func (r *memoryReviewRepository) GetByID(_ context.Context, id int) (m.Review, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+	review, ok := r.s.reviews[id]
+	if !ok {
+		return m.Review{}, ErrNotFound
+	}
+	return review, nil
+}
+
+func (r *memoryReviewRepository) List(_ context.Context) ([]m.Review, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+	return sortedValues(r.s.reviews), nil
+}
+
+func (r *memoryReviewRepository) ListByUser(_ context.Context, userID int) ([]m.Review, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+	var reviews []m.Review
+	for _, review := range sortedValues(r.s.reviews) {
+		if review.UserID == userID {
+			reviews = append(reviews, review)
+		}
+	}
+	return reviews, nil
+}
+
+func (r *memoryReviewRepository) Exists(_ context.Context, userID, gameID int) (bool, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+	for _, review := range r.s.reviews {
+		if review.UserID == userID && review.GameID == gameID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (r *memoryReviewRepository) Update(_ context.Context, review m.Review) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	existing, ok := r.s.reviews[review.ID]
+	if !ok {
+		return ErrNotFound
+	}
+	existing.Rating = review.Rating
+	existing.Description = review.Description
+	existing.UpdatedAt = review.UpdatedAt
+	r.s.reviews[review.ID] = existing
+	return nil
+}
+
+func (r *memoryReviewRepository) Delete(_ context.Context, id int) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	if _, ok := r.s.reviews[id]; !ok {
+		return ErrNotFound
+	}
+	delete(r.s.reviews, id)
+	return nil
+}
+
+// Wishlists
+
+type memoryWishlistRepository struct {
+	s *memoryStore
+}
+
+func (r *memoryWishlistRepository) Create(_ context.Context, wish *m.Wishlist) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	for _, existing := range r.s.wishlists {
+		if existing.GameID == wish.GameID {
+			return ErrDuplicate
+		}
+	}
+	wish.ID = r.s.id("wishlists", wish.ID)
+	r.s.wishlists[wish.ID] = *wish
+	return nil
+}
+
+func (r *memoryWishlistRepository) GetForUser(_ context.Context, id, userID int) (m.Wishlist, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+	wish, ok := r.s.wishlists[id]
+	if !ok || wish.UserID != userID {
+		return m.Wishlist{}, ErrNotFound
+	}
+	return wish, nil
+}
+
+func (r *memoryWishlistRepository) ListByUser(_ context.Context, userID int) ([]m.WishlistWithGameTitle, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+	var wishes []m.WishlistWithGameTitle
+	for _, wish := range sortedValues(r.s.wishlists) {
+		game, ok := r.s.games[wish.GameID]
+		if wish.UserID != userID || !ok {
+			continue
+		}
+		wishes = append(wishes, m.WishlistWithGameTitle{
+			ID:        wish.ID,
+			UserID:    wish.UserID,
+			GameTitle: game.Title,
+			CreatedAt: wish.CreatedAt,
+			UpdatedAt: wish.UpdatedAt,
+		})
+	}
+	return wishes, nil
+}
+
+func (r *memoryWishlistRepository) Exists(_ context.Context, userID, gameID int) (bool, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+	for _, wish := range r.s.wishlists {
+		if wish.UserID == userID && wish.GameID == gameID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (r *memoryWishlistRepository) Delete(_ context.Context, id int) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	if _, ok := r.s.wishlists[id]; !ok {
+		return ErrNotFound
+	}
+	delete(r.s.wishlists, id)
+	return nil
+}
+
+// Refresh tokens
+
+type memoryRefreshTokenRepository struct {
+	s *memoryStore
+}
+
+func (r *memoryRefreshTokenRepository) Create(_ context.Context, token *m.RefreshToken) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	for _, existing := range r.s.refreshTokens {
+		if existing.TokenHash == token.TokenHash {
+			return ErrDuplicate
+		}
+	}
+	token.ID = r.s.id("refresh_tokens", token.ID)
+	r.s.refreshTokens[token.ID] = *token
+	return nil
+}
+
+func (r *memoryRefreshTokenRepository) GetByHash(_ context.Context, hash string) (m.RefreshToken, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+	for _, token := range r.s.refreshTokens {
+		if token.TokenHash == hash {
+			return token, nil
+		}
+	}
+	return m.RefreshToken{}, ErrNotFound
+}
+
+func (r *memoryRefreshTokenRepository) Revoke(_ context.Context, id int) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	token, ok := r.s.refreshTokens[id]
+	if !ok || token.Revoked {
+		return ErrNotFound
+	}
+	token.Revoked = true
+	r.s.refreshTokens[id] = token
+	return nil
+}
+
+func (r *memoryRefreshTokenRepository) RevokeFamily(_ context.Context, familyID string) error {
+	r.s.revokeRefreshTokens(func(token m.RefreshToken) bool { return token.FamilyID == familyID })
+	return nil
+}
+
+func (r *memoryRefreshTokenRepository) RevokeUser(_ context.Context, userID int) error {
+	r.s.revokeRefreshTokens(func(token m.RefreshToken) bool { return token.UserID == userID })
+	return nil
+}
+
+func (s *memoryStore) revokeRefreshTokens(match func(m.RefreshToken) bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, token := range s.refreshTokens {
+		if match(token) {
+			token.Revoked = true
+			s.refreshTokens[id] = token
+		}
+	}
+}
+
+// Password resets
+
+type memoryPasswordResetRepository struct {
+	s *memoryStore
+}
+
+func (r *memoryPasswordResetRepository) Create(_ context.Context, reset *m.PasswordReset) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	for _, existing := range r.s.passwordResets {
+		if existing.TokenHash == reset.TokenHash {
+			return ErrDuplicate
+		}
+	}
+	reset.ID = r.s.id("password_resets", reset.ID)
+	r.s.passwordResets[reset.ID] = *reset
+	return nil
+}
+
+func (r *memoryPasswordResetRepository) GetByHash(_ context.Context, hash string) (m.PasswordReset, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+	for _, reset := range r.s.passwordResets {
+		if reset.TokenHash == hash {
+			return reset, nil
+		}
+	}
+	return m.PasswordReset{}, ErrNotFound
+}
+
+func (r *memoryPasswordResetRepository) Redeem(_ context.Context, id int, hash string, updatedAt m.MySQLTime) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	reset, ok := r.s.passwordResets[id]
+	if !ok || reset.Used {
+		return ErrNotFound
+	}
+	user, ok := r.s.users[reset.UserID]
+	if !ok {
+		return ErrNotFound
+	}
+	user.Password = hash
+	user.UpdatedAt = updatedAt
+	r.s.users[user.ID] = user
+	for id, other := range r.s.passwordResets {
+		if other.UserID == user.ID {
+			other.Used = true
+			r.s.passwordResets[id] = other
+		}
+	}
+	return nil
+}
+
+func (r *memoryPasswordResetRepository) UseAll(_ context.Context, userID int) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	for id, reset := range r.s.passwordResets {
+		if reset.UserID == userID {
+			reset.Used = true
+			r.s.passwordResets[id] = reset
+		}
+	}
+	return nil
+}
+
+// Recovery codes
+
+type memoryRecoveryCodeRepository struct {
+	s *memoryStore
+}
+
+func (r *memoryRecoveryCodeRepository) Replace(_ context.Context, userID int, codes []m.RecoveryCode) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	for id, code := range r.s.recoveryCodes {
+		if code.UserID == userID {
+			delete(r.s.recoveryCodes, id)
+		}
+	}
+	for _, code := range codes {
+		code.UserID = userID
+		code.ID = r.s.id("recovery_codes", 0)
+		r.s.recoveryCodes[code.ID] = code
+	}
+	return nil
+}
+
+func (r *memoryRecoveryCodeRepository) Use(_ context.Context, userID int, hash string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	for id, code := range r.s.recoveryCodes {
+		if code.UserID == userID && code.CodeHash == hash && !code.Used {
+			code.Used = true
+			r.s.recoveryCodes[id] = code
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (r *memoryRecoveryCodeRepository) CountUnused(_ context.Context, userID int) (int, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+	count := 0
+	for _, code := range r.s.recoveryCodes {
+		if code.UserID == userID && !code.Used {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// Identities
+
+type memoryIdentityRepository struct {
+	s *memoryStore
+}
+
+func (r *memoryIdentityRepository) Create(_ context.Context, identity *m.UserIdentity) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	for _, existing := range r.s.identities {
+		if existing.Issuer == identity.Issuer && existing.Subject == identity.Subject {
+			return ErrDuplicate
+		}
+	}
+	identity.ID = r.s.id("user_identities", identity.ID)
+	r.s.identities[identity.ID] = *identity
+	return nil
+}
+
+func (r *memoryIdentityRepository) GetBySubject(_ context.Context, issuer, subject string) (m.UserIdentity, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+	for _, identity := range r.s.identities {
+		if identity.Issuer == issuer && identity.Subject == subject {
+			return identity, nil
+		}
+	}
+	return m.UserIdentity{}, ErrNotFound
+}
+
+// API keys
+
+type memoryAPIKeyRepository struct {
+	s *memoryStore
+}
+
+func (r *memoryAPIKeyRepository) Create(_ context.Context, key *m.APIKey) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	for _, existing := range r.s.apiKeys {
+		if existing.KeyHash == key.KeyHash {
+			return ErrDuplicate
+		}
+	}
+	key.ID = r.s.id("api_keys", key.ID)
+	r.s.apiKeys[key.ID] = *key
+	return nil
+}
+
+func (r *memoryAPIKeyRepository) GetByHash(_ context.Context, hash string) (m.APIKey, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+	for _, key := range r.s.apiKeys {
+		if key.KeyHash == hash {
+			return key, nil
+		}
+	}
+	return m.APIKey{}, ErrNotFound
+}
+
+func (r *memoryAPIKeyRepository) ListByUser(_ context.Context, userID int) ([]m.APIKey, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+	keys := []m.APIKey{}
+	for _, key := range sortedValues(r.s.apiKeys) {
+		if key.UserID == userID && !key.Revoked {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+func (r *memoryAPIKeyRepository) Touch(_ context.Context, id int, lastUsed m.MySQLTime) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	key, ok := r.s.apiKeys[id]
+	if !ok {
+		return ErrNotFound
+	}
+	key.LastUsedAt = &lastUsed
+	r.s.apiKeys[id] = key
+	return nil
+}
+
+func (r *memoryAPIKeyRepository) Revoke(_ context.Context, id, userID int) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	key, ok := r.s.apiKeys[id]
+	if !ok || key.UserID != userID || key.Revoked {
+		return ErrNotFound
+	}
+	key.Revoked = true
+	r.s.apiKeys[id] = key
+	return nil
+}
+
+// Sessions
+
+type memorySessionRepository struct {
+	s *memoryStore
+}
+
+func (r *memorySessionRepository) Create(_ context.Context, session *m.Session) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	if _, ok := r.s.sessions[session.ID]; ok {
+		return ErrDuplicate
+	}
+	r.s.sessions[session.ID] = *session
+	return nil
+}
+
+func (r *memorySessionRepository) GetByID(_ context.Context, id string) (m.Session, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+	session, ok := r.s.sessions[id]
+	if !ok {
+		return m.Session{}, ErrNotFound
+	}
+	return session, nil
+}
+
+func (r *memorySessionRepository) ListByUser(_ context.Context, userID int) ([]m.Session, error) {
+	r.s.mu.RLock()
+	defer r.s.mu.RUnlock()
+	var sessions []m.Session
+	for _, session := range r.s.sessions {
+		if session.UserID == userID && !session.Revoked {
+			sessions = append(sessions, session)
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].LastSeenAt.After(sessions[j].LastSeenAt.Time)
+	})
+	return sessions, nil
+}
+
+func (r *memorySessionRepository) Touch(_ context.Context, id string, lastSeen m.MySQLTime) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	session, ok := r.s.sessions[id]
+	if !ok {
+		return ErrNotFound
+	}
+	session.LastSeenAt = lastSeen
+	r.s.sessions[id] = session
+	return nil
+}
+
+func (r *memorySessionRepository) Revoke(_ context.Context, id string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	session, ok := r.s.sessions[id]
+	if !ok || session.Revoked {
+		return ErrNotFound
+	}
+	session.Revoked = true
+	r.s.sessions[id] = session
+	return nil
+}
+
+func (r *memorySessionRepository) RevokeOthers(_ context.Context, userID int, keepID string) error {
+	r.s.mu.Lock()
+	defer r.s.mu.Unlock()
+	for id, session := range r.s.sessions {
+		if session.UserID == userID && id != keepID {
+			session.Revoked = true
+			r.s.sessions[id] = session
+		}
+	}
+	return nil
+}
@@ -0,0 +1,182 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	m "final-project/model"
+)
+
+var (
+	// ErrNotFound is returned when no row matches the lookup.
+	ErrNotFound = errors.New("record not found")
+	// ErrDuplicate is returned when a write violates a unique constraint.
+	ErrDuplicate = errors.New("record already exists")
+)
+
+type UserRepository interface {
+	Create(ctx context.Context, user *m.User) error
+	GetByID(ctx context.Context, id int) (m.User, error)
+	GetByEmail(ctx context.Context, email string) (m.User, error)
+	List(ctx context.Context) ([]m.User, error)
+	// CountWithPermission counts the users whose role has been granted the
+	// permission name.
+	CountWithPermission(ctx context.Context, name string) (int, error)
+	// CountByRole counts the users holding roleID.
+	CountByRole(ctx context.Context, roleID int) (int, error)
+	// UpdateProfile saves the name, avatar_url, bio, preferences and
+	// updated_at of user. It never writes the password, so a profile edit
+	// racing a password change cannot restore the old hash.
+	UpdateProfile(ctx context.Context, user m.User) error
+	// UpdatePassword saves hash as the bcrypt password hash of user id and
+	// updatedAt as its updated_at.
+	UpdatePassword(ctx context.Context, id int, hash string, updatedAt m.MySQLTime) error
+	// UpdateRole saves the role_id and updated_at of user.
+	UpdateRole(ctx context.Context, user m.User) error
+	// MarkEmailVerified sets email_verified for the user.
+	MarkEmailVerified(ctx context.Context, id int) error
+	// UpdateTwoFactor saves the totp_secret and two_factor_enabled of user
+	// and resets totp_last_step.
+	UpdateTwoFactor(ctx context.Context, user m.User) error
+	// UseTOTPStep records step as the last accepted TOTP step. It returns
+	// ErrNotFound unless step is newer than the recorded one, so a code is
+	// accepted at most once.
+	UseTOTPStep(ctx context.Context, id int, step int64) error
+	// RevokeTokens bumps token_version so every token issued so far stops
+	// being accepted.
+	RevokeTokens(ctx context.Context, id int) error
+	// Delete removes the user with their wishlist and everything else that
+	// belongs to the account. The user's reviews are kept without an author
+	// when anonymizeReviews is set and removed otherwise.
+	Delete(ctx context.Context, id int, anonymizeReviews bool) error
+}
+
+type RoleRepository interface {
+	// Create keeps role.ID when it is non-zero.
+	Create(ctx context.Context, role *m.Role) error
+	GetByID(ctx context.Context, id int) (m.Role, error)
+	GetByName(ctx context.Context, name string) (m.Role, error)
+	List(ctx context.Context) ([]m.Role, error)
+	// Update saves the role_name and updated_at of role.
+	Update(ctx context.Context, role m.Role) error
+	Delete(ctx context.Context, id int) error
+}
+
+type PermissionRepository interface {
+	Create(ctx context.Context, permission *m.Permission) error
+	GetByName(ctx context.Context, name string) (m.Permission, error)
+	List(ctx context.Context) ([]m.Permission, error)
+	ListByRole(ctx context.Context, roleID int) ([]m.Permission, error)
+	// HasPermission reports whether roleID has been granted the named permission.
+	HasPermission(ctx context.Context, roleID int, name string) (bool, error)
+	// Grant returns ErrDuplicate if the role already has the permission.
+	Grant(ctx context.Context, roleID, permissionID int) error
+	// Revoke returns ErrNotFound if the role does not have the permission.
+	Revoke(ctx context.Context, roleID, permissionID int) error
+}
+
+type GameRepository interface {
+	Create(ctx context.Context, game *m.Game) error
+	GetByID(ctx context.Context, id int) (m.Game, error)
+	List(ctx context.Context) ([]m.Game, error)
+	Update(ctx context.Context, game m.Game) error
+	Delete(ctx context.Context, id int) error
+	Exists(ctx context.Context, id int) (bool, error)
+}
+
+type ReviewRepository interface {
+	Create(ctx context.Context, review *m.Review) error
+	GetByID(ctx context.Context, id int) (m.Review, error)
+	List(ctx context.Context) ([]m.Review, error)
+	ListByUser(ctx context.Context, userID int) ([]m.Review, error)
+	// Exists reports whether userID already reviewed gameID.
+	Exists(ctx context.Context, userID, gameID int) (bool, error)
+	Update(ctx context.Context, review m.Review) error
+	Delete(ctx context.Context, id int) error
+}
+
+type WishlistRepository interface {
+	Create(ctx context.Context, wish *m.Wishlist) error
+	// GetForUser returns the wishlist item id only if it belongs to userID.
+	GetForUser(ctx context.Context, id, userID int) (m.Wishlist, error)
+	ListByUser(ctx context.Context, userID int) ([]m.WishlistWithGameTitle, error)
+	// Exists reports whether gameID is already on userID's wishlist.
+	Exists(ctx context.Context, userID, gameID int) (bool, error)
+	Delete(ctx context.Context, id int) error
+}
+
+type RefreshTokenRepository interface {
+	Create(ctx context.Context, token *m.RefreshToken) error
+	GetByHash(ctx context.Context, hash string) (m.RefreshToken, error)
+	// Revoke marks one token used. It returns ErrNotFound if the token was
+	// already revoked, so two concurrent refreshes cannot both succeed.
+	Revoke(ctx context.Context, id int) error
+	RevokeFamily(ctx context.Context, familyID string) error
+	RevokeUser(ctx context.Context, userID int) error
+}
+
+type PasswordResetRepository interface {
+	Create(ctx context.Context, reset *m.PasswordReset) error
+	GetByHash(ctx context.Context, hash string) (m.PasswordReset, error)
+	// Redeem marks token id used, sets the password of its user to hash
+	// and marks the user's other tokens used, all at once. It returns
+	// ErrNotFound if the token was already used, so it can only set a
+	// password once.
+	Redeem(ctx context.Context, id int, hash string, updatedAt m.MySQLTime) error
+	// UseAll marks every token of userID used.
+	UseAll(ctx context.Context, userID int) error
+}
+
+type RecoveryCodeRepository interface {
+	// Replace deletes the codes of userID and stores codes instead.
+	Replace(ctx context.Context, userID int, codes []m.RecoveryCode) error
+	// Use marks the unused code of userID with hash used. It returns
+	// ErrNotFound if there is none.
+	Use(ctx context.Context, userID int, hash string) error
+	CountUnused(ctx context.Context, userID int) (int, error)
+}
+
+type IdentityRepository interface {
+	// Create returns ErrDuplicate if the issuer and subject are already linked.
+	Create(ctx context.Context, identity *m.UserIdentity) error
+	GetBySubject(ctx context.Context, issuer, subject string) (m.UserIdentity, error)
+}
+
+type APIKeyRepository interface {
+	Create(ctx context.Context, key *m.APIKey) error
+	GetByHash(ctx context.Context, hash string) (m.APIKey, error)
+	// ListByUser returns the keys of userID that are not revoked.
+	ListByUser(ctx context.Context, userID int) ([]m.APIKey, error)
+	Touch(ctx context.Context, id int, lastUsed m.MySQLTime) error
+	// Revoke returns ErrNotFound unless userID owns an unrevoked key id.
+	Revoke(ctx context.Context, id, userID int) error
+}
+
+type SessionRepository interface {
+	Create(ctx context.Context, session *m.Session) error
+	GetByID(ctx context.Context, id string) (m.Session, error)
+	// ListByUser returns the sessions of userID that are not revoked.
+	ListByUser(ctx context.Context, userID int) ([]m.Session, error)
+	Touch(ctx context.Context, id string, lastSeen m.MySQLTime) error
+	// Revoke returns ErrNotFound if the session is unknown or already revoked.
+	Revoke(ctx context.Context, id string) error
+	// RevokeOthers revokes every session of userID except keepID.
+	RevokeOthers(ctx context.Context, userID int, keepID string) error
+}
+
+// Repositories bundles one implementation of every repository so a
+// storage backend can be swapped as a unit.
+type Repositories struct {
+	Users          UserRepository
+	Roles          RoleRepository
+	Permissions    PermissionRepository
+	RefreshTokens  RefreshTokenRepository
+	Sessions       SessionRepository
+	PasswordResets PasswordResetRepository
+	RecoveryCodes  RecoveryCodeRepository
+	APIKeys        APIKeyRepository
+	Identities     IdentityRepository
+	Games          GameRepository
+	Reviews        ReviewRepository
+	Wishlists      WishlistRepository
+}
@@ -0,0 +1,372 @@
+package repository_test
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"final-project/config"
+	d "final-project/db"
+	"final-project/migrations"
+	m "final-project/model"
+	"final-project/repository"
+	"final-project/seed"
+)
+
+// backends are the storage drivers every repository must behave the same
+// on. Each call opens an empty store.
+var backends = []struct {
+	name string
+	open func(t *testing.T) *repository.Repositories
+}{
+	{"memory", func(t *testing.T) *repository.Repositories { return repository.NewMemory() }},
+	{"sqlite", openSQLite},
+}
+
+func openSQLite(t *testing.T) *repository.Repositories {
+	t.Helper()
+	ctx := context.Background()
+	store, err := d.Open(ctx, &config.Config{
+		StorageDriver:    "sqlite",
+		SQLitePath:       filepath.Join(t.TempDir(), "test.sqlite"),
+		DBConnectTimeout: 5 * time.Second,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	migrator, err := migrations.New(store.DB, store.Driver)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := migrator.Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+	return repository.NewSQLite(store.DB)
+}
+
+// forEachBackend runs test against every backend, seeded with the built-in
+// roles and permissions.
+func forEachBackend(t *testing.T, test func(t *testing.T, repos *repository.Repositories)) {
+	for _, backend := range backends {
+		t.Run(backend.name, func(t *testing.T) {
+			repos := backend.open(t)
+			if err := seed.Run(context.Background(), repos, seed.Options{}); err != nil {
+				t.Fatal(err)
+			}
+			test(t, repos)
+		})
+	}
+}
+
+func now() m.MySQLTime {
+	return m.NewMySQLTime(time.Now())
+}
+
+func createUser(t *testing.T, repos *repository.Repositories, email string, roleID int) m.User {
+	t.Helper()
+	user := m.User{Email: email, Name: "Tester", Password: "hash", RoleId: roleID, CreatedAt: now(), UpdatedAt: now()}
+	if err := repos.Users.Create(context.Background(), &user); err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+func createGame(t *testing.T, repos *repository.Repositories) m.Game {
+	t.Helper()
+	game := m.Game{Title: "Test Game", CreatedAt: now(), UpdatedAt: now()}
+	if err := repos.Games.Create(context.Background(), &game); err != nil {
+		t.Fatal(err)
+	}
+	return game
+}
+
+func wantErr(t *testing.T, what string, err, want error) {
+	t.Helper()
+	if !errors.Is(err, want) {
+		t.Errorf("%s: error = %v, want %v", what, err, want)
+	}
+}
+
+func TestUsers(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, repos *repository.Repositories) {
+		ctx := context.Background()
+		user := createUser(t, repos, "user@example.com", 1)
+
+		duplicate := m.User{Email: user.Email, RoleId: 1, CreatedAt: now(), UpdatedAt: now()}
+		wantErr(t, "Create with a taken email", repos.Users.Create(ctx, &duplicate), repository.ErrDuplicate)
+		_, err := repos.Users.GetByID(ctx, user.ID+100)
+		wantErr(t, "GetByID of an unknown id", err, repository.ErrNotFound)
+		byEmail, err := repos.Users.GetByEmail(ctx, user.Email)
+		if err != nil || byEmail.ID != user.ID {
+			t.Errorf("GetByEmail() = %d, %v, want %d", byEmail.ID, err, user.ID)
+		}
+
+		// Saving unchanged values is not "not found".
+		wantErr(t, "UpdateProfile", repos.Users.UpdateProfile(ctx, user), nil)
+		wantErr(t, "UpdateProfile without changes", repos.Users.UpdateProfile(ctx, user), nil)
+		user.ID += 100
+		wantErr(t, "UpdateProfile of an unknown id", repos.Users.UpdateProfile(ctx, user), repository.ErrNotFound)
+		user.ID -= 100
+
+		changedAt := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+		wantErr(t, "UpdatePassword", repos.Users.UpdatePassword(ctx, user.ID, "new hash", m.NewMySQLTime(changedAt)), nil)
+		if stored, _ := repos.Users.GetByID(ctx, user.ID); !stored.UpdatedAt.Time.Equal(changedAt) {
+			t.Errorf("updated_at after UpdatePassword = %v, want %v", stored.UpdatedAt.Time, changedAt)
+		}
+		user.Name = "Renamed"
+		user.Password = "stale hash"
+		wantErr(t, "UpdateProfile", repos.Users.UpdateProfile(ctx, user), nil)
+		stored, err := repos.Users.GetByID(ctx, user.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stored.Name != "Renamed" || stored.Password != "new hash" {
+			t.Errorf("stored name, password = %q, %q, want %q, %q", stored.Name, stored.Password, "Renamed", "new hash")
+		}
+		wantErr(t, "UpdatePassword of an unknown id", repos.Users.UpdatePassword(ctx, user.ID+100, "hash", now()), repository.ErrNotFound)
+
+		steps := []struct {
+			step int64
+			want error
+		}{
+			{5, nil},
+			{5, repository.ErrNotFound},
+			{4, repository.ErrNotFound},
+			{6, nil},
+		}
+		for _, tt := range steps {
+			wantErr(t, "UseTOTPStep", repos.Users.UseTOTPStep(ctx, user.ID, tt.step), tt.want)
+		}
+
+		wantErr(t, "RevokeTokens", repos.Users.RevokeTokens(ctx, user.ID), nil)
+		if stored, _ := repos.Users.GetByID(ctx, user.ID); stored.TokenVersion != 1 {
+			t.Errorf("TokenVersion = %d, want 1", stored.TokenVersion)
+		}
+		wantErr(t, "RevokeTokens of an unknown id", repos.Users.RevokeTokens(ctx, user.ID+100), repository.ErrNotFound)
+
+	})
+}
+
+// TestPermissionCatalog checks that the permissions the migrations insert
+// read the same as the catalog the seed uses.
+func TestPermissionCatalog(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, repos *repository.Repositories) {
+		for _, want := range m.Permissions {
+			got, err := repos.Permissions.GetByName(context.Background(), want.Name)
+			if err != nil {
+				t.Fatalf("GetByName(%q): %v", want.Name, err)
+			}
+			if got.Description != want.Description {
+				t.Errorf("%s description = %q, want %q", want.Name, got.Description, want.Description)
+			}
+		}
+	})
+}
+
+func TestCountWithPermission(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, repos *repository.Repositories) {
+		ctx := context.Background()
+		count := func(want int) {
+			t.Helper()
+			got, err := repos.Users.CountWithPermission(ctx, m.PermManageUsers)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != want {
+				t.Errorf("CountWithPermission() = %d, want %d", got, want)
+			}
+		}
+
+		user := createUser(t, repos, "user@example.com", m.RoleUser)
+		count(0)
+		createUser(t, repos, "admin@example.com", m.RoleAdmin)
+		count(1)
+
+		moderators := m.Role{RoleName: "moderator", CreatedAt: now(), UpdatedAt: now()}
+		if err := repos.Roles.Create(ctx, &moderators); err != nil {
+			t.Fatal(err)
+		}
+		permission, err := repos.Permissions.GetByName(ctx, m.PermManageUsers)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := repos.Permissions.Grant(ctx, moderators.ID, permission.ID); err != nil {
+			t.Fatal(err)
+		}
+		user.RoleId = moderators.ID
+		if err := repos.Users.UpdateRole(ctx, user); err != nil {
+			t.Fatal(err)
+		}
+		count(2)
+		if err := repos.Permissions.Revoke(ctx, m.RoleAdmin, permission.ID); err != nil {
+			t.Fatal(err)
+		}
+		count(1)
+
+		for roleID, want := range map[int]int{m.RoleUser: 0, m.RoleAdmin: 1, moderators.ID: 1} {
+			if got, err := repos.Users.CountByRole(ctx, roleID); err != nil || got != want {
+				t.Errorf("CountByRole(%d) = %d, %v, want %d", roleID, got, err, want)
+			}
+		}
+	})
+}
+
+func TestWishlists(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, repos *repository.Repositories) {
+		ctx := context.Background()
+		user := createUser(t, repos, "user@example.com", 1)
+		other := createUser(t, repos, "other@example.com", 1)
+		game := createGame(t, repos)
+
+		wish := m.Wishlist{UserID: user.ID, GameID: game.ID, CreatedAt: now(), UpdatedAt: now()}
+		if err := repos.Wishlists.Create(ctx, &wish); err != nil {
+			t.Fatal(err)
+		}
+		if exists, err := repos.Wishlists.Exists(ctx, user.ID, game.ID); err != nil || !exists {
+			t.Errorf("Exists() = %v, %v, want true", exists, err)
+		}
+		_, err := repos.Wishlists.GetForUser(ctx, wish.ID, other.ID)
+		wantErr(t, "GetForUser by another user", err, repository.ErrNotFound)
+		list, err := repos.Wishlists.ListByUser(ctx, user.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(list) != 1 || list[0].GameTitle != game.Title {
+			t.Errorf("ListByUser() = %+v, want one item titled %q", list, game.Title)
+		}
+		wantErr(t, "Delete", repos.Wishlists.Delete(ctx, wish.ID), nil)
+		wantErr(t, "Delete again", repos.Wishlists.Delete(ctx, wish.ID), repository.ErrNotFound)
+	})
+}
+
+func TestSingleUse(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, repos *repository.Repositories) {
+		ctx := context.Background()
+		user := createUser(t, repos, "user@example.com", 1)
+		other := createUser(t, repos, "other@example.com", 1)
+
+		session := m.Session{ID: "session", UserID: user.ID, CreatedAt: now(), LastSeenAt: now()}
+		if err := repos.Sessions.Create(ctx, &session); err != nil {
+			t.Fatal(err)
+		}
+		refresh := m.RefreshToken{UserID: user.ID, FamilyID: session.ID, TokenHash: "refresh", ExpiresAt: now(), CreatedAt: now()}
+		if err := repos.RefreshTokens.Create(ctx, &refresh); err != nil {
+			t.Fatal(err)
+		}
+		reset := m.PasswordReset{UserID: user.ID, TokenHash: "reset", ExpiresAt: now(), CreatedAt: now()}
+		if err := repos.PasswordResets.Create(ctx, &reset); err != nil {
+			t.Fatal(err)
+		}
+
+		codes := []m.RecoveryCode{{UserID: user.ID, CodeHash: "code", CreatedAt: now()}}
+		if err := repos.RecoveryCodes.Replace(ctx, user.ID, codes); err != nil {
+			t.Fatal(err)
+		}
+
+		key := m.APIKey{UserID: user.ID, Name: "key", Prefix: "fp_", KeyHash: "key", Scopes: m.Scopes{m.ScopeAccount}, ExpiresAt: now(), CreatedAt: now()}
+		if err := repos.APIKeys.Create(ctx, &key); err != nil {
+			t.Fatal(err)
+		}
+
+		tests := []struct {
+			name string
+			use  func() error
+		}{
+			{"refresh token", func() error { return repos.RefreshTokens.Revoke(ctx, refresh.ID) }},
+			{"password reset", func() error { return repos.PasswordResets.Redeem(ctx, reset.ID, "new-hash", now()) }},
+			{"recovery code", func() error { return repos.RecoveryCodes.Use(ctx, user.ID, "code") }},
+			{"session", func() error { return repos.Sessions.Revoke(ctx, session.ID) }},
+			{"API key", func() error { return repos.APIKeys.Revoke(ctx, key.ID, user.ID) }},
+		}
+		// Another user cannot revoke the key before its owner does.
+		wantErr(t, "APIKeys.Revoke by another user", repos.APIKeys.Revoke(ctx, key.ID, other.ID), repository.ErrNotFound)
+		for _, tt := range tests {
+			wantErr(t, tt.name+" first use", tt.use(), nil)
+			wantErr(t, tt.name+" second use", tt.use(), repository.ErrNotFound)
+		}
+		got, err := repos.Users.GetByID(ctx, user.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Password != "new-hash" {
+			t.Errorf("password after Redeem = %q, want %q", got.Password, "new-hash")
+		}
+	})
+}
+
+func TestDeleteUser(t *testing.T) {
+	tests := []struct {
+		name             string
+		anonymizeReviews bool
+		wantReviews      int
+	}{
+		{"anonymize reviews", true, 1},
+		{"delete reviews", false, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			forEachBackend(t, func(t *testing.T, repos *repository.Repositories) {
+				ctx := context.Background()
+				user := createUser(t, repos, "user@example.com", 1)
+				game := createGame(t, repos)
+				review := m.Review{UserID: user.ID, GameID: game.ID, Rating: 8, Description: "Fun", CreatedAt: now(), UpdatedAt: now()}
+				if err := repos.Reviews.Create(ctx, &review); err != nil {
+					t.Fatal(err)
+				}
+				wish := m.Wishlist{UserID: user.ID, GameID: game.ID, CreatedAt: now(), UpdatedAt: now()}
+				if err := repos.Wishlists.Create(ctx, &wish); err != nil {
+					t.Fatal(err)
+				}
+				session := m.Session{ID: "session", UserID: user.ID, CreatedAt: now(), LastSeenAt: now()}
+				if err := repos.Sessions.Create(ctx, &session); err != nil {
+					t.Fatal(err)
+				}
+				refresh := m.RefreshToken{UserID: user.ID, FamilyID: session.ID, TokenHash: "refresh", ExpiresAt: now(), CreatedAt: now()}
+				if err := repos.RefreshTokens.Create(ctx, &refresh); err != nil {
+					t.Fatal(err)
+				}
+				key := m.APIKey{UserID: user.ID, Name: "key", Prefix: "fp_", KeyHash: "key", Scopes: m.Scopes{m.ScopeAccount}, ExpiresAt: now(), CreatedAt: now()}
+				if err := repos.APIKeys.Create(ctx, &key); err != nil {
+					t.Fatal(err)
+				}
+
+				if err := repos.Users.Delete(ctx, user.ID, tt.anonymizeReviews); err != nil {
+					t.Fatal(err)
+				}
+				wantErr(t, "Delete again", repos.Users.Delete(ctx, user.ID, tt.anonymizeReviews), repository.ErrNotFound)
+
+				_, err := repos.Users.GetByID(ctx, user.ID)
+				wantErr(t, "Users.GetByID", err, repository.ErrNotFound)
+				_, err = repos.Sessions.GetByID(ctx, session.ID)
+				wantErr(t, "Sessions.GetByID", err, repository.ErrNotFound)
+				_, err = repos.RefreshTokens.GetByHash(ctx, refresh.TokenHash)
+				wantErr(t, "RefreshTokens.GetByHash", err, repository.ErrNotFound)
+				_, err = repos.APIKeys.GetByHash(ctx, key.KeyHash)
+				wantErr(t, "APIKeys.GetByHash", err, repository.ErrNotFound)
+
+				wishlist, err := repos.Wishlists.ListByUser(ctx, user.ID)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(wishlist) != 0 {
+					t.Errorf("%d wishlist items left, want 0", len(wishlist))
+				}
+				reviews, err := repos.Reviews.List(ctx)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(reviews) != tt.wantReviews {
+					t.Fatalf("%d reviews left, want %d", len(reviews), tt.wantReviews)
+				}
+				for _, review := range reviews {
+					if review.UserID != 0 || review.Author != m.DeletedUserName {
+						t.Errorf("kept review has user_id %d and author %q, want 0 and %q", review.UserID, review.Author, m.DeletedUserName)
+					}
+				}
+			})
+		})
+	}
+}
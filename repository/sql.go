@@ -0,0 +1,797 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	m "final-project/model"
+
+	"github.com/go-sql-driver/mysql"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// NewMySQL returns repositories backed by the MySQL schema in sql.txt.
+func NewMySQL(db *sql.DB) *Repositories {
+	return newSQL(db)
+}
+
+// NewSQLite returns repositories backed by the SQLite translation of sql.txt.
+// The queries are shared with MySQL; only error codes differ.
+func NewSQLite(db *sql.DB) *Repositories {
+	return newSQL(db)
+}
+
+func newSQL(db *sql.DB) *Repositories {
+	return &Repositories{
+		Users:          &sqlUserRepository{db: db},
+		Roles:          &sqlRoleRepository{db: db},
+		Permissions:    &sqlPermissionRepository{db: db},
+		RefreshTokens:  &sqlRefreshTokenRepository{db: db},
+		Sessions:       &sqlSessionRepository{db: db},
+		PasswordResets: &sqlPasswordResetRepository{db: db},
+		RecoveryCodes:  &sqlRecoveryCodeRepository{db: db},
+		APIKeys:        &sqlAPIKeyRepository{db: db},
+		Identities:     &sqlIdentityRepository{db: db},
+		Games:          &sqlGameRepository{db: db},
+		Reviews:        &sqlReviewRepository{db: db},
+		Wishlists:      &sqlWishlistRepository{db: db},
+	}
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// execer is a *sql.DB or a *sql.Tx.
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// sqlError maps MySQL and SQLite driver errors onto the package sentinels.
+func sqlError(err error) error {
+	var myErr *mysql.MySQLError
+	var liteErr *sqlite.Error
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return ErrNotFound
+	case errors.As(err, &myErr) && myErr.Number == 1062:
+		return ErrDuplicate
+	case errors.As(err, &liteErr) && (liteErr.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE || liteErr.Code() == sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY):
+		return ErrDuplicate
+	}
+	return err
+}
+
+// exec runs a write and reports ErrNotFound when it matched no row. MySQL
+// counts matched rather than changed rows only with clientFoundRows, which
+// db.Open sets.
+func exec(ctx context.Context, db execer, query string, args ...interface{}) error {
+	result, err := db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return sqlError(err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func insert(ctx context.Context, db *sql.DB, query string, args ...interface{}) (int, error) {
+	result, err := db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, sqlError(err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	return int(id), nil
+}
+
+func exists(ctx context.Context, db *sql.DB, query string, args ...interface{}) (bool, error) {
+	var count int
+	if err := db.QueryRowContext(ctx, query, args...).Scan(&count); err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// Users
+
+const userColumns = "id, email, name, password, role_id, access_token, active, avatar_url, bio, preferences, email_verified, two_factor_enabled, totp_secret, totp_last_step, token_version, created_at, updated_at"
+
+type sqlUserRepository struct {
+	db *sql.DB
+}
+
+func scanUser(row scanner) (m.User, error) {
+	var user m.User
+	err := row.Scan(&user.ID, &user.Email, &user.Name, &user.Password, &user.RoleId, &user.AccessToken, &user.Active, &user.AvatarURL, &user.Bio, &user.Preferences, &user.EmailVerified, &user.TwoFactorEnabled, &user.TOTPSecret, &user.TOTPLastStep, &user.TokenVersion, &user.CreatedAt, &user.UpdatedAt)
+	return user, sqlError(err)
+}
+
+func (r *sqlUserRepository) Create(ctx context.Context, user *m.User) error {
+	id, err := insert(ctx, r.db, "INSERT INTO users (email, name, password, role_id, access_token, active, avatar_url, bio, preferences, email_verified, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		user.Email, user.Name, user.Password, user.RoleId, user.AccessToken, user.Active, user.AvatarURL, user.Bio, user.Preferences, user.EmailVerified, user.CreatedAt, user.UpdatedAt)
+	if err != nil {
+		return err
+	}
+	user.ID = id
+	return nil
+}
+
+func (r *sqlUserRepository) GetByID(ctx context.Context, id int) (m.User, error) {
+	return scanUser(r.db.QueryRowContext(ctx, "SELECT "+userColumns+" FROM users WHERE id = ?", id))
+}
+
+func (r *sqlUserRepository) GetByEmail(ctx context.Context, email string) (m.User, error) {
+	return scanUser(r.db.QueryRowContext(ctx, "SELECT "+userColumns+" FROM users WHERE email = ?", email))
+}
+
+func (r *sqlUserRepository) List(ctx context.Context) ([]m.User, error) {
+	rows, err := r.db.QueryContext(ctx, "SELECT "+userColumns+" FROM users")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []m.User
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+func (r *sqlUserRepository) CountWithPermission(ctx context.Context, name string) (int, error) {
+	var count int
+	err := r.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM users u JOIN role_permissions rp ON rp.role_id = u.role_id JOIN permissions p ON p.id = rp.permission_id WHERE p.name = ?", name).Scan(&count)
+	return count, err
+}
+
+func (r *sqlUserRepository) CountByRole(ctx context.Context, roleID int) (int, error) {
+	var count int
+	err := r.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM users WHERE role_id = ?", roleID).Scan(&count)
+	return count, err
+}
+
+func (r *sqlUserRepository) UpdateProfile(ctx context.Context, user m.User) error {
+	return exec(ctx, r.db, "UPDATE users SET name = ?, avatar_url = ?, bio = ?, preferences = ?, updated_at = ? WHERE id = ?",
+		user.Name, user.AvatarURL, user.Bio, user.Preferences, user.UpdatedAt, user.ID)
+}
+
+func (r *sqlUserRepository) UpdatePassword(ctx context.Context, id int, hash string, updatedAt m.MySQLTime) error {
+	return exec(ctx, r.db, "UPDATE users SET password = ?, updated_at = ? WHERE id = ?", hash, updatedAt, id)
+}
+
+func (r *sqlUserRepository) UpdateRole(ctx context.Context, user m.User) error {
+	return exec(ctx, r.db, "UPDATE users SET role_id = ?, updated_at = ? WHERE id = ?",
+		user.RoleId, user.UpdatedAt, user.ID)
+}
+
+func (r *sqlUserRepository) MarkEmailVerified(ctx context.Context, id int) error {
+	return exec(ctx, r.db, "UPDATE users SET email_verified = ? WHERE id = ?", true, id)
+}
+
+func (r *sqlUserRepository) UpdateTwoFactor(ctx context.Context, user m.User) error {
+	return exec(ctx, r.db, "UPDATE users SET totp_secret = ?, two_factor_enabled = ?, totp_last_step = 0 WHERE id = ?",
+		user.TOTPSecret, user.TwoFactorEnabled, user.ID)
+}
+
+func (r *sqlUserRepository) UseTOTPStep(ctx context.Context, id int, step int64) error {
+	return exec(ctx, r.db, "UPDATE users SET totp_last_step = ? WHERE id = ? AND totp_last_step < ?", step, id, step)
+}
+
+func (r *sqlUserRepository) RevokeTokens(ctx context.Context, id int) error {
+	return exec(ctx, r.db, "UPDATE users SET token_version = token_version + 1 WHERE id = ?", id)
+}
+
+func (r *sqlUserRepository) Delete(ctx context.Context, id int, anonymizeReviews bool) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// reviews and wishlists reference users without ON DELETE; the other
+	// tables cascade.
+	reviews := "DELETE FROM reviews WHERE user_id = ?"
+	if anonymizeReviews {
+		reviews = "UPDATE reviews SET user_id = NULL WHERE user_id = ?"
+	}
+	if _, err := tx.ExecContext(ctx, reviews, id); err != nil {
+		return sqlError(err)
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM wishlists WHERE user_id = ?", id); err != nil {
+		return sqlError(err)
+	}
+	if err := exec(ctx, tx, "DELETE FROM users WHERE id = ?", id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Roles
+
+type sqlRoleRepository struct {
+	db *sql.DB
+}
+
+func scanRole(row scanner) (m.Role, error) {
+	var role m.Role
+	err := row.Scan(&role.ID, &role.RoleName, &role.CreatedAt, &role.UpdatedAt)
+	return role, sqlError(err)
+}
+
+// Create inserts role, keeping role.ID when it is set so well-known roles
+// can be seeded with fixed ids.
+func (r *sqlRoleRepository) Create(ctx context.Context, role *m.Role) error {
+	var id int
+	var err error
+	if role.ID > 0 {
+		id, err = insert(ctx, r.db, "INSERT INTO roles (id, role_name, created_at, updated_at) VALUES (?, ?, ?, ?)",
+			role.ID, role.RoleName, role.CreatedAt, role.UpdatedAt)
+	} else {
+		id, err = insert(ctx, r.db, "INSERT INTO roles (role_name, created_at, updated_at) VALUES (?, ?, ?)",
+			role.RoleName, role.CreatedAt, role.UpdatedAt)
+	}
+	if err != nil {
+		return err
+	}
+	role.ID = id
+	return nil
+}
+
+func (r *sqlRoleRepository) GetByID(ctx context.Context, id int) (m.Role, error) {
+	return scanRole(r.db.QueryRowContext(ctx, "SELECT id, role_name, created_at, updated_at FROM roles WHERE id = ?", id))
+}
+
+func (r *sqlRoleRepository) GetByName(ctx context.Context, name string) (m.Role, error) {
+	return scanRole(r.db.QueryRowContext(ctx, "SELECT id, role_name, created_at, updated_at FROM roles WHERE role_name = ?", name))
+}
+
+func (r *sqlRoleRepository) List(ctx context.Context) ([]m.Role, error) {
+	rows, err := r.db.QueryContext(ctx, "SELECT id, role_name, created_at, updated_at FROM roles")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var roles []m.Role
+	for rows.Next() {
+		role, err := scanRole(rows)
+		if err != nil {
+			return nil, err
+		}
+		roles = append(roles, role)
+	}
+	return roles, rows.Err()
+}
+
+func (r *sqlRoleRepository) Update(ctx context.Context, role m.Role) error {
+	return exec(ctx, r.db, "UPDATE roles SET role_name = ?, updated_at = ? WHERE id = ?", role.RoleName, role.UpdatedAt, role.ID)
+}
+
+func (r *sqlRoleRepository) Delete(ctx context.Context, id int) error {
+	return exec(ctx, r.db, "DELETE FROM roles WHERE id = ?", id)
+}
+
+// Permissions
+
+type sqlPermissionRepository struct {
+	db *sql.DB
+}
+
+func (r *sqlPermissionRepository) query(ctx context.Context, query string, args ...interface{}) ([]m.Permission, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var permissions []m.Permission
+	for rows.Next() {
+		var permission m.Permission
+		if err := rows.Scan(&permission.ID, &permission.Name, &permission.Description, &permission.CreatedAt, &permission.UpdatedAt); err != nil {
+			return nil, err
+		}
+		permissions = append(permissions, permission)
+	}
+	return permissions, rows.Err()
+}
+
+func (r *sqlPermissionRepository) Create(ctx context.Context, permission *m.Permission) error {
+	id, err := insert(ctx, r.db, "INSERT INTO permissions (name, description, created_at, updated_at) VALUES (?, ?, ?, ?)",
+		permission.Name, permission.Description, permission.CreatedAt, permission.UpdatedAt)
+	if err != nil {
+		return err
+	}
+	permission.ID = id
+	return nil
+}
+
+func (r *sqlPermissionRepository) GetByName(ctx context.Context, name string) (m.Permission, error) {
+	var permission m.Permission
+	err := r.db.QueryRowContext(ctx, "SELECT id, name, description, created_at, updated_at FROM permissions WHERE name = ?", name).
+		Scan(&permission.ID, &permission.Name, &permission.Description, &permission.CreatedAt, &permission.UpdatedAt)
+	return permission, sqlError(err)
+}
+
+func (r *sqlPermissionRepository) List(ctx context.Context) ([]m.Permission, error) {
+	return r.query(ctx, "SELECT id, name, description, created_at, updated_at FROM permissions ORDER BY name")
+}
+
+func (r *sqlPermissionRepository) ListByRole(ctx context.Context, roleID int) ([]m.Permission, error) {
+	return r.query(ctx, "SELECT p.id, p.name, p.description, p.created_at, p.updated_at FROM permissions p JOIN role_permissions rp ON rp.permission_id = p.id WHERE rp.role_id = ? ORDER BY p.name", roleID)
+}
+
+func (r *sqlPermissionRepository) HasPermission(ctx context.Context, roleID int, name string) (bool, error) {
+	return exists(ctx, r.db, "SELECT COUNT(*) FROM role_permissions rp JOIN permissions p ON p.id = rp.permission_id WHERE rp.role_id = ? AND p.name = ?", roleID, name)
+}
+
+func (r *sqlPermissionRepository) Grant(ctx context.Context, roleID, permissionID int) error {
+	_, err := r.db.ExecContext(ctx, "INSERT INTO role_permissions (role_id, permission_id) VALUES (?, ?)", roleID, permissionID)
+	return sqlError(err)
+}
+
+func (r *sqlPermissionRepository) Revoke(ctx context.Context, roleID, permissionID int) error {
+	return exec(ctx, r.db, "DELETE FROM role_permissions WHERE role_id = ? AND permission_id = ?", roleID, permissionID)
+}
+
+// Games
+
+const gameColumns = "id, title, developer, release_date, description, created_at, updated_at"
+
+type sqlGameRepository struct {
+	db *sql.DB
+}
+
+func scanGame(row scanner) (m.Game, error) {
+	var game m.Game
+	err := row.Scan(&game.ID, &game.Title, &game.Developer, &game.ReleaseDate, &game.Description, &game.CreatedAt, &game.UpdatedAt)
+	return game, sqlError(err)
+}
+
+func (r *sqlGameRepository) Create(ctx context.Context, game *m.Game) error {
+	id, err := insert(ctx, r.db, "INSERT INTO games (title, developer, release_date, description, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?)",
+		game.Title, game.Developer, game.ReleaseDate, game.Description, game.CreatedAt, game.UpdatedAt)
+	if err != nil {
+		return err
+	}
+	game.ID = id
+	return nil
+}
+
+func (r *sqlGameRepository) GetByID(ctx context.Context, id int) (m.Game, error) {
+	return scanGame(r.db.QueryRowContext(ctx, "SELECT "+gameColumns+" FROM games WHERE id = ?", id))
+}
+
+func (r *sqlGameRepository) List(ctx context.Context) ([]m.Game, error) {
+	rows, err := r.db.QueryContext(ctx, "SELECT "+gameColumns+" FROM games")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var games []m.Game
+	for rows.Next() {
+		game, err := scanGame(rows)
+		if err != nil {
+			return nil, err
+		}
+		games = append(games, game)
+	}
+	return games, rows.Err()
+}
+
+func (r *sqlGameRepository) Update(ctx context.Context, game m.Game) error {
+	return exec(ctx, r.db, "UPDATE games SET title = ?, developer = ?, release_date = ?, description = ?, updated_at = ? WHERE id = ?",
+		game.Title, game.Developer, game.ReleaseDate, game.Description, game.UpdatedAt, game.ID)
+}
+
+func (r *sqlGameRepository) Delete(ctx context.Context, id int) error {
+	return exec(ctx, r.db, "DELETE FROM games WHERE id = ?", id)
+}
+
+func (r *sqlGameRepository) Exists(ctx context.Context, id int) (bool, error) {
+	return exists(ctx, r.db, "SELECT COUNT(*) FROM games WHERE id = ?", id)
+}
+
+// Reviews
+
+// reviewColumns reads the user_id of an anonymized review as 0.
+const reviewColumns = "id, COALESCE(user_id, 0), game_id, rating, description, created_at, updated_at"
+
+type sqlReviewRepository struct {
+	db *sql.DB
+}
+
+func scanReview(row scanner) (m.Review, error) {
+	var review m.Review
+	err := row.Scan(&review.ID, &review.UserID, &review.GameID, &review.Rating, &review.Description, &review.CreatedAt, &review.UpdatedAt)
+	if err == nil && review.UserID == 0 {
+		review.Author = m.DeletedUserName
+	}
+	return review, sqlError(err)
+}
+
+func (r *sqlReviewRepository) query(ctx context.Context, query string, args ...interface{}) ([]m.Review, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var reviews []m.Review
+	for rows.Next() {
+		review, err := scanReview(rows)
+		if err != nil {
+			return nil, err
+		}
+		reviews = append(reviews, review)
+	}
+	return reviews, rows.Err()
+}
+
+func (r *sqlReviewRepository) Create(ctx context.Context, review *m.Review) error {
+	id, err := insert(ctx, r.db, "INSERT INTO reviews (user_id, game_id, description, rating, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?)",
+		review.UserID, review.GameID, review.Description, review.Rating, review.CreatedAt, review.UpdatedAt)
+	if err != nil {
+		return err
+	}
+	review.ID = id
+	return nil
+}
+
+func (r *sqlReviewRepository) GetByID(ctx context.Context, id int) (m.Review, error) {
+	return scanReview(r.db.QueryRowContext(ctx, "SELECT "+reviewColumns+" FROM reviews WHERE id = ?", id))
+}
+
+func (r *sqlReviewRepository) List(ctx context.Context) ([]m.Review, error) {
+	return r.query(ctx, "SELECT "+reviewColumns+" FROM reviews")
+}
+
+func (r *sqlReviewRepository) ListByUser(ctx context.Context, userID int) ([]m.Review, error) {
+	return r.query(ctx, "SELECT "+reviewColumns+" FROM reviews WHERE user_id = ?", userID)
+}
+
+func (r *sqlReviewRepository) Exists(ctx context.Context, userID, gameID int) (bool, error) {
+	return exists(ctx, r.db, "SELECT COUNT(*) FROM reviews WHERE user_id = ? AND game_id = ?", userID, gameID)
+}
+
+func (r *sqlReviewRepository) Update(ctx context.Context, review m.Review) error {
+	return exec(ctx, r.db, "UPDATE reviews SET rating = ?, description = ?, updated_at = ? WHERE id = ?",
+		review.Rating, review.Description, review.UpdatedAt, review.ID)
+}
+
+func (r *sqlReviewRepository) Delete(ctx context.Context, id int) error {
+	return exec(ctx, r.db, "DELETE FROM reviews WHERE id = ?", id)
+}
+
+// Wishlists
+
+type sqlWishlistRepository struct {
+	db *sql.DB
+}
+
+func (r *sqlWishlistRepository) Create(ctx context.Context, wish *m.Wishlist) error {
+	id, err := insert(ctx, r.db, "INSERT INTO wishlists (user_id, game_id, created_at, updated_at) VALUES (?, ?, ?, ?)",
+		wish.UserID, wish.GameID, wish.CreatedAt, wish.UpdatedAt)
+	if err != nil {
+		return err
+	}
+	wish.ID = id
+	return nil
+}
+
+func (r *sqlWishlistRepository) GetForUser(ctx context.Context, id, userID int) (m.Wishlist, error) {
+	var wish m.Wishlist
+	err := r.db.QueryRowContext(ctx, "SELECT id, user_id, game_id, created_at, updated_at FROM wishlists WHERE id = ? AND user_id = ?", id, userID).
+		Scan(&wish.ID, &wish.UserID, &wish.GameID, &wish.CreatedAt, &wish.UpdatedAt)
+	return wish, sqlError(err)
+}
+
+func (r *sqlWishlistRepository) ListByUser(ctx context.Context, userID int) ([]m.WishlistWithGameTitle, error) {
+	rows, err := r.db.QueryContext(ctx, "SELECT w.id, w.user_id, g.title AS game_title, w.created_at, w.updated_at FROM wishlists w JOIN games g ON w.game_id = g.id WHERE w.user_id = ?", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var wishes []m.WishlistWithGameTitle
+	for rows.Next() {
+		var wish m.WishlistWithGameTitle
+		if err := rows.Scan(&wish.ID, &wish.UserID, &wish.GameTitle, &wish.CreatedAt, &wish.UpdatedAt); err != nil {
+			return nil, err
+		}
+		wishes = append(wishes, wish)
+	}
+	return wishes, rows.Err()
+}
+
+func (r *sqlWishlistRepository) Exists(ctx context.Context, userID, gameID int) (bool, error) {
+	return exists(ctx, r.db, "SELECT COUNT(*) FROM wishlists WHERE game_id = ? AND user_id = ?", gameID, userID)
+}
+
+func (r *sqlWishlistRepository) Delete(ctx context.Context, id int) error {
+	return exec(ctx, r.db, "DELETE FROM wishlists WHERE id = ?", id)
+}
+
+// Refresh tokens
+
+const refreshTokenColumns = "id, user_id, family_id, token_hash, device, revoked, expires_at, created_at"
+
+type sqlRefreshTokenRepository struct {
+	db *sql.DB
+}
+
+func scanRefreshToken(row scanner) (m.RefreshToken, error) {
+	var token m.RefreshToken
+	err := row.Scan(&token.ID, &token.UserID, &token.FamilyID, &token.TokenHash, &token.Device, &token.Revoked, &token.ExpiresAt, &token.CreatedAt)
+	return token, sqlError(err)
+}
+
+func (r *sqlRefreshTokenRepository) Create(ctx context.Context, token *m.RefreshToken) error {
+	id, err := insert(ctx, r.db, "INSERT INTO refresh_tokens (user_id, family_id, token_hash, device, revoked, expires_at, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		token.UserID, token.FamilyID, token.TokenHash, token.Device, token.Revoked, token.ExpiresAt, token.CreatedAt)
+	if err != nil {
+		return err
+	}
+	token.ID = id
+	return nil
+}
+
+func (r *sqlRefreshTokenRepository) GetByHash(ctx context.Context, hash string) (m.RefreshToken, error) {
+	return scanRefreshToken(r.db.QueryRowContext(ctx, "SELECT "+refreshTokenColumns+" FROM refresh_tokens WHERE token_hash = ?", hash))
+}
+
+func (r *sqlRefreshTokenRepository) Revoke(ctx context.Context, id int) error {
+	return exec(ctx, r.db, "UPDATE refresh_tokens SET revoked = TRUE WHERE id = ? AND revoked = FALSE", id)
+}
+
+func (r *sqlRefreshTokenRepository) RevokeFamily(ctx context.Context, familyID string) error {
+	_, err := r.db.ExecContext(ctx, "UPDATE refresh_tokens SET revoked = TRUE WHERE family_id = ?", familyID)
+	return err
+}
+
+func (r *sqlRefreshTokenRepository) RevokeUser(ctx context.Context, userID int) error {
+	_, err := r.db.ExecContext(ctx, "UPDATE refresh_tokens SET revoked = TRUE WHERE user_id = ?", userID)
+	return err
+}
+
+// Password resets
+
+const passwordResetColumns = "id, user_id, token_hash, used, expires_at, created_at"
+
+type sqlPasswordResetRepository struct {
+	db *sql.DB
+}
+
+func scanPasswordReset(row scanner) (m.PasswordReset, error) {
+	var reset m.PasswordReset
+	err := row.Scan(&reset.ID, &reset.UserID, &reset.TokenHash, &reset.Used, &reset.ExpiresAt, &reset.CreatedAt)
+	return reset, sqlError(err)
+}
+
+func (r *sqlPasswordResetRepository) Create(ctx context.Context, reset *m.PasswordReset) error {
+	id, err := insert(ctx, r.db, "INSERT INTO password_resets (user_id, token_hash, used, expires_at, created_at) VALUES (?, ?, ?, ?, ?)",
+		reset.UserID, reset.TokenHash, reset.Used, reset.ExpiresAt, reset.CreatedAt)
+	if err != nil {
+		return err
+	}
+	reset.ID = id
+	return nil
+}
+
+func (r *sqlPasswordResetRepository) GetByHash(ctx context.Context, hash string) (m.PasswordReset, error) {
+	return scanPasswordReset(r.db.QueryRowContext(ctx, "SELECT "+passwordResetColumns+" FROM password_resets WHERE token_hash = ?", hash))
+}
+
+// Redeem runs in one transaction so a token is never spent without the
+// password changing.
+func (r *sqlPasswordResetRepository) Redeem(ctx context.Context, id int, hash string, updatedAt m.MySQLTime) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := exec(ctx, tx, "UPDATE password_resets SET used = TRUE WHERE id = ? AND used = FALSE", id); err != nil {
+		return err
+	}
+	var userID int
+	if err := tx.QueryRowContext(ctx, "SELECT user_id FROM password_resets WHERE id = ?", id).Scan(&userID); err != nil {
+		return sqlError(err)
+	}
+	if err := exec(ctx, tx, "UPDATE users SET password = ?, updated_at = ? WHERE id = ?", hash, updatedAt, userID); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "UPDATE password_resets SET used = TRUE WHERE user_id = ?", userID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *sqlPasswordResetRepository) UseAll(ctx context.Context, userID int) error {
+	_, err := r.db.ExecContext(ctx, "UPDATE password_resets SET used = TRUE WHERE user_id = ?", userID)
+	return err
+}
+
+// Recovery codes
+
+type sqlRecoveryCodeRepository struct {
+	db *sql.DB
+}
+
+// Replace swaps the whole set in one transaction so a failure cannot leave
+// the user with a partial set of codes.
+func (r *sqlRecoveryCodeRepository) Replace(ctx context.Context, userID int, codes []m.RecoveryCode) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM recovery_codes WHERE user_id = ?", userID); err != nil {
+		return err
+	}
+	for _, code := range codes {
+		_, err := tx.ExecContext(ctx, "INSERT INTO recovery_codes (user_id, code_hash, used, created_at) VALUES (?, ?, ?, ?)",
+			userID, code.CodeHash, code.Used, code.CreatedAt)
+		if err != nil {
+			return sqlError(err)
+		}
+	}
+	return tx.Commit()
+}
+
+func (r *sqlRecoveryCodeRepository) Use(ctx context.Context, userID int, hash string) error {
+	return exec(ctx, r.db, "UPDATE recovery_codes SET used = TRUE WHERE user_id = ? AND code_hash = ? AND used = FALSE", userID, hash)
+}
+
+func (r *sqlRecoveryCodeRepository) CountUnused(ctx context.Context, userID int) (int, error) {
+	var count int
+	err := r.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM recovery_codes WHERE user_id = ? AND used = FALSE", userID).Scan(&count)
+	return count, err
+}
+
+// Identities
+
+type sqlIdentityRepository struct {
+	db *sql.DB
+}
+
+func (r *sqlIdentityRepository) Create(ctx context.Context, identity *m.UserIdentity) error {
+	id, err := insert(ctx, r.db, "INSERT INTO user_identities (user_id, issuer, subject, email, created_at) VALUES (?, ?, ?, ?, ?)",
+		identity.UserID, identity.Issuer, identity.Subject, identity.Email, identity.CreatedAt)
+	if err != nil {
+		return err
+	}
+	identity.ID = id
+	return nil
+}
+
+func (r *sqlIdentityRepository) GetBySubject(ctx context.Context, issuer, subject string) (m.UserIdentity, error) {
+	var identity m.UserIdentity
+	err := r.db.QueryRowContext(ctx, "SELECT id, user_id, issuer, subject, email, created_at FROM user_identities WHERE issuer = ? AND subject = ?", issuer, subject).
+		Scan(&identity.ID, &identity.UserID, &identity.Issuer, &identity.Subject, &identity.Email, &identity.CreatedAt)
+	return identity, sqlError(err)
+}
+
+// API keys
+
+const apiKeyColumns = "id, user_id, name, prefix, key_hash, scopes, revoked, expires_at, last_used_at, created_at"
+
+type sqlAPIKeyRepository struct {
+	db *sql.DB
+}
+
+func scanAPIKey(row scanner) (m.APIKey, error) {
+	var key m.APIKey
+	err := row.Scan(&key.ID, &key.UserID, &key.Name, &key.Prefix, &key.KeyHash, &key.Scopes, &key.Revoked, &key.ExpiresAt, &key.LastUsedAt, &key.CreatedAt)
+	return key, sqlError(err)
+}
+
+func (r *sqlAPIKeyRepository) Create(ctx context.Context, key *m.APIKey) error {
+	id, err := insert(ctx, r.db, "INSERT INTO api_keys (user_id, name, prefix, key_hash, scopes, revoked, expires_at, last_used_at, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		key.UserID, key.Name, key.Prefix, key.KeyHash, key.Scopes, key.Revoked, key.ExpiresAt, key.LastUsedAt, key.CreatedAt)
+	if err != nil {
+		return err
+	}
+	key.ID = id
+	return nil
+}
+
+func (r *sqlAPIKeyRepository) GetByHash(ctx context.Context, hash string) (m.APIKey, error) {
+	return scanAPIKey(r.db.QueryRowContext(ctx, "SELECT "+apiKeyColumns+" FROM api_keys WHERE key_hash = ?", hash))
+}
+
+func (r *sqlAPIKeyRepository) ListByUser(ctx context.Context, userID int) ([]m.APIKey, error) {
+	rows, err := r.db.QueryContext(ctx, "SELECT "+apiKeyColumns+" FROM api_keys WHERE user_id = ? AND revoked = FALSE ORDER BY id", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []m.APIKey{}
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+func (r *sqlAPIKeyRepository) Touch(ctx context.Context, id int, lastUsed m.MySQLTime) error {
+	return exec(ctx, r.db, "UPDATE api_keys SET last_used_at = ? WHERE id = ?", lastUsed, id)
+}
+
+func (r *sqlAPIKeyRepository) Revoke(ctx context.Context, id, userID int) error {
+	return exec(ctx, r.db, "UPDATE api_keys SET revoked = TRUE WHERE id = ? AND user_id = ? AND revoked = FALSE", id, userID)
+}
+
+// Sessions
+
+const sessionColumns = "id, user_id, device, ip_address, user_agent, revoked, created_at, last_seen_at"
+
+type sqlSessionRepository struct {
+	db *sql.DB
+}
+
+func scanSession(row scanner) (m.Session, error) {
+	var session m.Session
+	err := row.Scan(&session.ID, &session.UserID, &session.Device, &session.IPAddress, &session.UserAgent, &session.Revoked, &session.CreatedAt, &session.LastSeenAt)
+	return session, sqlError(err)
+}
+
+func (r *sqlSessionRepository) Create(ctx context.Context, session *m.Session) error {
+	_, err := r.db.ExecContext(ctx, "INSERT INTO sessions ("+sessionColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+		session.ID, session.UserID, session.Device, session.IPAddress, session.UserAgent, session.Revoked, session.CreatedAt, session.LastSeenAt)
+	return sqlError(err)
+}
+
+func (r *sqlSessionRepository) GetByID(ctx context.Context, id string) (m.Session, error) {
+	return scanSession(r.db.QueryRowContext(ctx, "SELECT "+sessionColumns+" FROM sessions WHERE id = ?", id))
+}
+
+func (r *sqlSessionRepository) ListByUser(ctx context.Context, userID int) ([]m.Session, error) {
+	rows, err := r.db.QueryContext(ctx, "SELECT "+sessionColumns+" FROM sessions WHERE user_id = ? AND revoked = FALSE ORDER BY last_seen_at DESC", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []m.Session
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, rows.Err()
+}
+
+func (r *sqlSessionRepository) Touch(ctx context.Context, id string, lastSeen m.MySQLTime) error {
+	return exec(ctx, r.db, "UPDATE sessions SET last_seen_at = ? WHERE id = ?", lastSeen, id)
+}
+
+func (r *sqlSessionRepository) Revoke(ctx context.Context, id string) error {
+	return exec(ctx, r.db, "UPDATE sessions SET revoked = TRUE WHERE id = ? AND revoked = FALSE", id)
+}
+
+func (r *sqlSessionRepository) RevokeOthers(ctx context.Context, userID int, keepID string) error {
+	_, err := r.db.ExecContext(ctx, "UPDATE sessions SET revoked = TRUE WHERE user_id = ? AND id <> ?", userID, keepID)
+	return err
+}
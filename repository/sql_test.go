@@ -0,0 +1,79 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"final-project/config"
+	d "final-project/db"
+)
+
+func TestMain(main *testing.M) {
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	os.Exit(main.Run())
+}
+
+// TestExecMatchedRows checks that exec reports ErrNotFound only for writes
+// that match no row, including writes that leave a row unchanged. MySQL
+// runs against the server in TEST_MYSQL_DSN when it is set.
+func TestExecMatchedRows(t *testing.T) {
+	drivers := []struct {
+		name string
+		cfg  func(t *testing.T) *config.Config
+	}{
+		{"sqlite", func(t *testing.T) *config.Config {
+			return &config.Config{StorageDriver: "sqlite", SQLitePath: filepath.Join(t.TempDir(), "test.sqlite")}
+		}},
+		{"mysql", func(t *testing.T) *config.Config {
+			dsn := os.Getenv("TEST_MYSQL_DSN")
+			if dsn == "" {
+				t.Skip("TEST_MYSQL_DSN is not set")
+			}
+			return &config.Config{StorageDriver: "mysql", DatabaseDSN: dsn}
+		}},
+	}
+	for _, driver := range drivers {
+		t.Run(driver.name, func(t *testing.T) {
+			ctx := context.Background()
+			cfg := driver.cfg(t)
+			// One connection, so the temporary table is visible to every query.
+			cfg.DBMaxOpenConns = 1
+			cfg.DBMaxIdleConns = 1
+			cfg.DBConnectTimeout = 5 * time.Second
+			store, err := d.Open(ctx, cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer store.Close()
+			if _, err := store.ExecContext(ctx, "CREATE TEMPORARY TABLE exec_test (id INT PRIMARY KEY, value INT NOT NULL)"); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := store.ExecContext(ctx, "INSERT INTO exec_test (id, value) VALUES (1, 1)"); err != nil {
+				t.Fatal(err)
+			}
+
+			tests := []struct {
+				name  string
+				id    int
+				value int
+				want  error
+			}{
+				{"changed row", 1, 2, nil},
+				{"unchanged row", 1, 2, nil},
+				{"missing row", 2, 2, ErrNotFound},
+			}
+			for _, tt := range tests {
+				err := exec(ctx, store.DB, "UPDATE exec_test SET value = ? WHERE id = ?", tt.value, tt.id)
+				if !errors.Is(err, tt.want) {
+					t.Errorf("%s: exec() error = %v, want %v", tt.name, err, tt.want)
+				}
+			}
+		})
+	}
+}
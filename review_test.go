@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+
+	m "final-project/model"
+)
+
+func TestDeleteReviewModeration(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+		// caller returns the credentials of whoever deletes the review.
+		caller func(s *testServer) http.Header
+		want   int
+	}{
+		{
+			name:   "author",
+			caller: func(s *testServer) http.Header { return bearer(s.login("user@example.com", testPassword).access) },
+			want:   http.StatusOK,
+		},
+		{
+			name: "another user",
+			caller: func(s *testServer) http.Header {
+				s.register("other@example.com")
+				return bearer(s.login("other@example.com", testPassword).access)
+			},
+			want: http.StatusNotFound,
+		},
+		{
+			name:   "moderator",
+			caller: func(s *testServer) http.Header { return bearer(s.login(adminEmail, testPassword).access) },
+			want:   http.StatusOK,
+		},
+		{
+			name: "moderator API key without the scope",
+			caller: func(s *testServer) http.Header {
+				admin := s.login(adminEmail, testPassword)
+				response := s.expect(http.StatusCreated, "POST", "/api-keys", bearer(admin.access), m.APIKeyRequest{Name: "test", Scopes: []string{m.ScopeAccount}})
+				return apiKey(response["key"].(string))
+			},
+			want: http.StatusNotFound,
+		},
+		{
+			name:   "moderator without required two-factor",
+			env:    map[string]string{"REQUIRE_ADMIN_2FA": "true"},
+			caller: func(s *testServer) http.Header { return bearer(s.login(adminEmail, testPassword).access) },
+			want:   http.StatusNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, tt.env)
+			game := m.Game{Title: "Test Game"}
+			if err := s.repos.Games.Create(context.Background(), &game); err != nil {
+				t.Fatal(err)
+			}
+			s.register("user@example.com")
+			author := s.login("user@example.com", testPassword)
+			response := s.expect(http.StatusOK, "POST", "/game/review", bearer(author.access), m.Review{GameID: game.ID, Rating: 8, Description: "Fun"})
+			path := fmt.Sprintf("/review/%d", int(response["review"].(map[string]interface{})["id"].(float64)))
+
+			if w := s.do("DELETE", path, tt.caller(s), nil); w.Code != tt.want {
+				t.Errorf("DELETE %s = %d, want %d", path, w.Code, tt.want)
+			}
+		})
+	}
+}
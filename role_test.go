@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	m "final-project/model"
+)
+
+func TestUpdateUserRole(t *testing.T) {
+	s := newTestServer(t, nil)
+	admin := s.login(adminEmail, testPassword)
+	adminID := s.userID(adminEmail)
+	s.register("user@example.com")
+	userID := s.userID("user@example.com")
+	user := s.login("user@example.com", testPassword)
+	detail := fmt.Sprintf("/user/detail/%d", adminID)
+
+	steps := []struct {
+		name   string
+		token  string
+		method string
+		path   string
+		body   interface{}
+		want   int
+	}{
+		{"users cannot view users", user.access, "GET", detail, nil, http.StatusForbidden},
+		{"users cannot change roles", user.access, "PUT", fmt.Sprintf("/user/%d/role", userID), m.UserRoleRequest{RoleID: m.RoleAdmin}, http.StatusForbidden},
+		{"unknown role", admin.access, "PUT", fmt.Sprintf("/user/%d/role", userID), m.UserRoleRequest{RoleID: 99}, http.StatusBadRequest},
+		{"unknown user", admin.access, "PUT", "/user/99/role", m.UserRoleRequest{RoleID: m.RoleAdmin}, http.StatusNotFound},
+		{"promote", admin.access, "PUT", fmt.Sprintf("/user/%d/role", userID), m.UserRoleRequest{RoleID: m.RoleAdmin}, http.StatusOK},
+		// The role is read on every request, so the old token carries the new one.
+		{"new role applies at once", user.access, "GET", detail, nil, http.StatusOK},
+	}
+	for _, step := range steps {
+		if w := s.do(step.method, step.path, bearer(step.token), step.body); w.Code != step.want {
+			t.Fatalf("%s: %s %s = %d %q, want %d", step.name, step.method, step.path, w.Code, strings.TrimSpace(w.Body.String()), step.want)
+		}
+	}
+}
+
+func TestDeleteRole(t *testing.T) {
+	s := newTestServer(t, nil)
+	admin := s.login(adminEmail, testPassword)
+	s.register("user@example.com")
+	userID := s.userID("user@example.com")
+	newRole := func(name string) int {
+		t.Helper()
+		response := s.expect(http.StatusOK, "POST", "/role", bearer(admin.access), m.Role{RoleName: name})
+		return int(response["role"].(map[string]interface{})["id"].(float64))
+	}
+	moderatorID := newRole("moderator")
+	s.expect(http.StatusOK, "PUT", fmt.Sprintf("/user/%d/role", userID), bearer(admin.access), m.UserRoleRequest{RoleID: moderatorID})
+	held := fmt.Sprintf("/role/%d", moderatorID)
+	unused := fmt.Sprintf("/role/%d", newRole("editor"))
+
+	steps := []struct {
+		name string
+		path string
+		want int
+	}{
+		{"user role is built in", fmt.Sprintf("/role/%d", m.RoleUser), http.StatusConflict},
+		{"admin role is built in", fmt.Sprintf("/role/%d", m.RoleAdmin), http.StatusConflict},
+		{"role held by a user", held, http.StatusConflict},
+		{"unused role", unused, http.StatusOK},
+		{"deleted role", unused, http.StatusNotFound},
+	}
+	for _, step := range steps {
+		if w := s.do("DELETE", step.path, bearer(admin.access), nil); w.Code != step.want {
+			t.Errorf("%s: DELETE %s = %d %q, want %d", step.name, step.path, w.Code, strings.TrimSpace(w.Body.String()), step.want)
+		}
+	}
+}
+
+func TestRevokeLastManagerPermission(t *testing.T) {
+	s := newTestServer(t, nil)
+	admin := s.login(adminEmail, testPassword)
+	s.register("user@example.com")
+	userID := s.userID("user@example.com")
+	response := s.expect(http.StatusOK, "POST", "/role", bearer(admin.access), m.Role{RoleName: "moderator"})
+	moderatorID := int(response["role"].(map[string]interface{})["id"].(float64))
+	moderators := fmt.Sprintf("/role/%d/permissions", moderatorID)
+	admins := fmt.Sprintf("/role/%d/permissions", m.RoleAdmin)
+
+	steps := []struct {
+		name   string
+		method string
+		path   string
+		body   interface{}
+		want   int
+	}{
+		{"admins keep roles:manage", "DELETE", admins + "/" + m.PermManageRoles, nil, http.StatusConflict},
+		{"admins keep users:manage", "DELETE", admins + "/" + m.PermManageUsers, nil, http.StatusConflict},
+		{"grant users:manage to moderators", "POST", moderators, m.RolePermissionRequest{Permission: m.PermManageUsers}, http.StatusOK},
+		{"moderators without users do not count", "DELETE", admins + "/" + m.PermManageUsers, nil, http.StatusConflict},
+		{"make the user a moderator", "PUT", fmt.Sprintf("/user/%d/role", userID), m.UserRoleRequest{RoleID: moderatorID}, http.StatusOK},
+		{"admins may lose users:manage", "DELETE", admins + "/" + m.PermManageUsers, nil, http.StatusOK},
+		{"moderators keep users:manage", "DELETE", moderators + "/" + m.PermManageUsers, nil, http.StatusConflict},
+	}
+	for _, step := range steps {
+		if w := s.do(step.method, step.path, bearer(admin.access), step.body); w.Code != step.want {
+			t.Fatalf("%s: %s %s = %d %q, want %d", step.name, step.method, step.path, w.Code, strings.TrimSpace(w.Body.String()), step.want)
+		}
+	}
+}
+
+func TestAdminUserActive(t *testing.T) {
+	s := newTestServer(t, nil)
+	admin := s.login(adminEmail, testPassword)
+	s.register("user@example.com")
+	detail := fmt.Sprintf("/user/detail/%d", s.userID("user@example.com"))
+
+	active := func() interface{} {
+		t.Helper()
+		return s.expect(http.StatusOK, "GET", detail, bearer(admin.access), nil)["active"]
+	}
+	if got := active(); got != false {
+		t.Errorf("active before login = %v, want false", got)
+	}
+	session := s.login("user@example.com", testPassword)
+	if got := active(); got != true {
+		t.Errorf("active after login = %v, want true", got)
+	}
+	s.expect(http.StatusOK, "POST", "/user/logout", bearer(session.access), nil)
+	if got := active(); got != false {
+		t.Errorf("active after logout = %v, want false", got)
+	}
+}
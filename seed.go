@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"final-project/config"
+	h "final-project/helper"
+	"final-project/seed"
+	"flag"
+)
+
+// runSeed implements "seed [-demo]".
+func runSeed(cfg *config.Config, args []string) error {
+	flags := flag.NewFlagSet("seed", flag.ContinueOnError)
+	demo := flags.Bool("demo", cfg.SeedDemoGames, "also create demo games")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if cfg.StorageDriver == "memory" {
+		return errors.New("the memory storage driver does not persist; use SEED_ON_START instead")
+	}
+
+	if err := h.Configure(cfg); err != nil {
+		return err
+	}
+	ctx := context.Background()
+	repos, closeStorage, err := openStorage(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer closeStorage()
+
+	opts := seedOptions(cfg)
+	opts.DemoGames = *demo
+	return seed.Run(ctx, repos, opts)
+}
+
+func seedOptions(cfg *config.Config) seed.Options {
+	return seed.Options{
+		AdminEmail:    cfg.SeedAdminEmail,
+		AdminName:     cfg.SeedAdminName,
+		AdminPassword: cfg.SeedAdminPassword,
+		DemoGames:     cfg.SeedDemoGames,
+	}
+}
@@ -0,0 +1,176 @@
+package seed
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	h "final-project/helper"
+	m "final-project/model"
+	"final-project/repository"
+)
+
+type Options struct {
+	AdminEmail    string
+	AdminName     string
+	AdminPassword string
+	DemoGames     bool
+}
+
+// Run creates the built-in roles, the permission catalog granted to the
+// admin role, the initial admin when AdminEmail is set and, optionally, a
+// few demo games. Anything that already exists is left
+// untouched, so Run is safe to repeat.
+func Run(ctx context.Context, repos *repository.Repositories, opts Options) error {
+	if _, err := ensureRole(ctx, repos.Roles, m.RoleUser, "user"); err != nil {
+		return err
+	}
+	newAdminRole, err := ensureRole(ctx, repos.Roles, m.RoleAdmin, "admin")
+	if err != nil {
+		return err
+	}
+	if err := ensurePermissions(ctx, repos.Permissions, newAdminRole); err != nil {
+		return err
+	}
+	if opts.AdminEmail != "" {
+		if err := ensureAdmin(ctx, repos.Users, opts); err != nil {
+			return err
+		}
+	}
+	if opts.DemoGames {
+		if err := ensureDemoGames(ctx, repos.Games); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ensureRole creates role id unless it exists and reports whether it did.
+func ensureRole(ctx context.Context, roles repository.RoleRepository, id int, name string) (bool, error) {
+	// Admins may rename the built-in roles, so only the id matters here.
+	_, err := roles.GetByID(ctx, id)
+	if err == nil {
+		return false, nil
+	} else if !errors.Is(err, repository.ErrNotFound) {
+		return false, err
+	}
+
+	now := m.NewMySQLTime(time.Now())
+	role := m.Role{ID: id, RoleName: name, CreatedAt: now, UpdatedAt: now}
+	err = roles.Create(ctx, &role)
+	if errors.Is(err, repository.ErrDuplicate) {
+		return false, fmt.Errorf("seed: a role named %q already exists with another id; cannot create role %d", name, id)
+	} else if err != nil {
+		return false, err
+	}
+	slog.Info("Created role", "role", name, "id", id)
+	return true, nil
+}
+
+// ensurePermissions creates the missing permissions of the catalog and
+// grants them to the admin role, or every permission when the admin role was
+// just created. Grants an admin revoked later are not restored.
+func ensurePermissions(ctx context.Context, permissions repository.PermissionRepository, newAdminRole bool) error {
+	for _, permission := range m.Permissions {
+		existing, err := permissions.GetByName(ctx, permission.Name)
+		created := errors.Is(err, repository.ErrNotFound)
+		if created {
+			now := m.NewMySQLTime(time.Now())
+			existing = permission
+			existing.CreatedAt = now
+			existing.UpdatedAt = now
+			err = permissions.Create(ctx, &existing)
+			if err == nil {
+				slog.Info("Created permission", "permission", existing.Name)
+			}
+		}
+		if err != nil {
+			return err
+		}
+		if !created && !newAdminRole {
+			continue
+		}
+
+		err = permissions.Grant(ctx, m.RoleAdmin, existing.ID)
+		if err != nil && !errors.Is(err, repository.ErrDuplicate) {
+			return err
+		}
+	}
+	return nil
+}
+
+func ensureAdmin(ctx context.Context, users repository.UserRepository, opts Options) error {
+	existing, err := users.GetByEmail(ctx, opts.AdminEmail)
+	if err == nil {
+		if existing.RoleId != m.RoleAdmin {
+			slog.Warn("Seed admin email belongs to a non-admin user", "email", opts.AdminEmail, "role_id", existing.RoleId)
+		}
+		return nil
+	} else if !errors.Is(err, repository.ErrNotFound) {
+		return err
+	}
+
+	if !h.IsValidEmail(opts.AdminEmail) {
+		return fmt.Errorf("seed: invalid admin email %q", opts.AdminEmail)
+	}
+	if err := h.ValidatePassword(opts.AdminPassword); err != nil {
+		return fmt.Errorf("seed: admin password: %w", err)
+	}
+	hashedPassword, err := h.HashPassword(opts.AdminPassword)
+	if err != nil {
+		return err
+	}
+
+	name := opts.AdminName
+	if name == "" {
+		name = "Administrator"
+	}
+	now := m.NewMySQLTime(time.Now())
+	admin := m.User{
+		Email:         opts.AdminEmail,
+		Name:          name,
+		Password:      hashedPassword,
+		RoleId:        m.RoleAdmin,
+		EmailVerified: true,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+	if err := users.Create(ctx, &admin); err != nil {
+		return err
+	}
+	slog.Info("Created admin user", "email", admin.Email, "id", admin.ID)
+	return nil
+}
+
+var demoGames = []m.Game{
+	{Title: "Hollow Knight", Developer: "Team Cherry", ReleaseDate: "2017-02-24", Description: "A hand-drawn action adventure through a ruined insect kingdom."},
+	{Title: "Stardew Valley", Developer: "ConcernedApe", ReleaseDate: "2016-02-26", Description: "A farming life sim about restoring your grandfather's old farm."},
+	{Title: "Celeste", Developer: "Maddy Makes Games", ReleaseDate: "2018-01-25", Description: "A precision platformer about climbing a mountain."},
+}
+
+func ensureDemoGames(ctx context.Context, games repository.GameRepository) error {
+	existing, err := games.List(ctx)
+	if err != nil {
+		return err
+	}
+	titles := make(map[string]bool, len(existing))
+	for _, game := range existing {
+		titles[game.Title] = true
+	}
+
+	now := m.NewMySQLTime(time.Now())
+	for _, game := range demoGames {
+		if titles[game.Title] {
+			continue
+		}
+		game.CreatedAt = now
+		game.UpdatedAt = now
+		if err := games.Create(ctx, &game); err != nil {
+			return err
+		}
+		slog.Info("Created demo game", "title", game.Title, "id", game.ID)
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package seed
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"testing"
+
+	m "final-project/model"
+	"final-project/repository"
+)
+
+func TestMain(main *testing.M) {
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	os.Exit(main.Run())
+}
+
+func TestRunKeepsRevokedGrants(t *testing.T) {
+	ctx := context.Background()
+	repos := repository.NewMemory()
+	if err := Run(ctx, repos, Options{}); err != nil {
+		t.Fatal(err)
+	}
+	granted, err := repos.Permissions.ListByRole(ctx, m.RoleAdmin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(granted) != len(m.Permissions) {
+		t.Fatalf("admin has %d permissions after the first run, want %d", len(granted), len(m.Permissions))
+	}
+
+	permission, err := repos.Permissions.GetByName(ctx, m.PermModerateReviews)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := repos.Permissions.Revoke(ctx, m.RoleAdmin, permission.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := Run(ctx, repos, Options{}); err != nil {
+		t.Fatal(err)
+	}
+	has, err := repos.Permissions.HasPermission(ctx, m.RoleAdmin, m.PermModerateReviews)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if has {
+		t.Error("a second run granted the revoked permission again")
+	}
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"final-project/config"
+	c "final-project/controller"
+	h "final-project/helper"
+	"final-project/mailer"
+	mw "final-project/middleware"
+	m "final-project/model"
+	"final-project/oidc"
+	"final-project/repository"
+	"final-project/seed"
+)
+
+const (
+	adminEmail    = "admin@example.com"
+	testPassword  = "Correct-Horse-42"
+	otherPassword = "Battery-Staple-77"
+)
+
+func TestMain(main *testing.M) {
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	os.Exit(main.Run())
+}
+
+// captureMailer hands every sent message to the test, or fails with err
+// when it is set.
+type captureMailer struct {
+	sent chan mailer.Message
+	err  error
+}
+
+func (ml *captureMailer) Send(_ context.Context, msg mailer.Message) error {
+	if ml.err != nil {
+		return ml.err
+	}
+	ml.sent <- msg
+	return nil
+}
+
+// testServer is the router of serve on the memory backend, with the admin
+// seeded.
+type testServer struct {
+	t       *testing.T
+	handler http.Handler
+	repos   *repository.Repositories
+	mail    *captureMailer
+}
+
+// newTestServer configures the app from env on top of the defaults. The
+// helper package keeps its settings in globals, so tests using it must not
+// run in parallel.
+func newTestServer(t *testing.T, env map[string]string) *testServer {
+	t.Helper()
+	configFile := filepath.Join(t.TempDir(), "test.env")
+	if err := os.WriteFile(configFile, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("CONFIG_FILE", configFile)
+	t.Setenv("STORAGE_DRIVER", "memory")
+	t.Setenv("BCRYPT_COST", "4")
+	for key, value := range env {
+		t.Setenv(key, value)
+	}
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatalf("config.Load() error = %v", err)
+	}
+	h.Configure(cfg)
+
+	repos := repository.NewMemory()
+	h.UseRepositories(repos.Users, repos.Sessions)
+	err = seed.Run(context.Background(), repos, seed.Options{AdminEmail: adminEmail, AdminPassword: testPassword})
+	if err != nil {
+		t.Fatalf("seed.Run() error = %v", err)
+	}
+
+	mail := &captureMailer{sent: make(chan mailer.Message, 10)}
+	authn := mw.NewAuthenticator(repos.Users, repos.APIKeys)
+	authz := mw.NewAuthorizer(authn, repos.Permissions, cfg.RequireAdminTwoFactor)
+	ctl := c.New(repos, c.Options{
+		Mailer:                mail,
+		RequireVerifiedEmail:  cfg.EmailVerification,
+		BaseURL:               cfg.BaseURL,
+		PasswordResetURL:      cfg.PasswordResetURL,
+		RequireAdminTwoFactor: cfg.RequireAdminTwoFactor,
+		AnonymizeReviews:      cfg.DeletedUserReviews == "anonymize",
+		OIDC:                  oidc.New(cfg),
+		Authorizer:            authz,
+	})
+	return &testServer{
+		t:       t,
+		handler: mw.CORS(cfg.CORSOrigins, newRouter(ctl, authn, authz)),
+		repos:   repos,
+		mail:    mail,
+	}
+}
+
+func bearer(token string) http.Header {
+	return http.Header{"Authorization": {"Bearer " + token}}
+}
+
+func apiKey(key string) http.Header {
+	header := http.Header{}
+	header.Set(mw.APIKeyHeader, key)
+	return header
+}
+
+// do sends a request with body encoded as JSON and returns the response.
+func (s *testServer) do(method, path string, header http.Header, body interface{}) *httptest.ResponseRecorder {
+	s.t.Helper()
+	var payload bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&payload).Encode(body); err != nil {
+			s.t.Fatal(err)
+		}
+	}
+	r := httptest.NewRequest(method, path, &payload)
+	for key, values := range header {
+		r.Header[key] = values
+	}
+	w := httptest.NewRecorder()
+	s.handler.ServeHTTP(w, r)
+	return w
+}
+
+// expect sends a request, fails the test unless it answers with status and
+// returns the decoded JSON object, if any.
+func (s *testServer) expect(status int, method, path string, header http.Header, body interface{}) map[string]interface{} {
+	s.t.Helper()
+	w := s.do(method, path, header, body)
+	if w.Code != status {
+		s.t.Fatalf("%s %s = %d %q, want %d", method, path, w.Code, strings.TrimSpace(w.Body.String()), status)
+	}
+	response := map[string]interface{}{}
+	if strings.HasPrefix(w.Header().Get("Content-Type"), "application/json") {
+		json.Unmarshal(w.Body.Bytes(), &response)
+	}
+	return response
+}
+
+// credentials is the body of POST /user and POST /user/login.
+func credentials(email, password string) map[string]string {
+	return map[string]string{"name": "Tester", "email": email, "password": password}
+}
+
+type tokens struct {
+	access  string
+	refresh string
+}
+
+func (s *testServer) register(email string) {
+	s.t.Helper()
+	s.expect(http.StatusOK, "POST", "/user", nil, credentials(email, testPassword))
+}
+
+func (s *testServer) login(email, password string) tokens {
+	s.t.Helper()
+	response := s.expect(http.StatusOK, "POST", "/user/login", nil, credentials(email, password))
+	return tokens{access: response["access_token"].(string), refresh: response["refresh_token"].(string)}
+}
+
+// currentSession returns the id of the session session.access belongs to.
+func (s *testServer) currentSession(session tokens) string {
+	s.t.Helper()
+	w := s.do("GET", "/sessions", bearer(session.access), nil)
+	var sessions []m.Session
+	if err := json.Unmarshal(w.Body.Bytes(), &sessions); err != nil {
+		s.t.Fatalf("GET /sessions: %v", err)
+	}
+	for _, session := range sessions {
+		if session.Current {
+			return session.ID
+		}
+	}
+	s.t.Fatal("GET /sessions lists no current session")
+	return ""
+}
+
+// mailedLink waits for the next email, which must go to address, and
+// returns the link in it.
+func (s *testServer) mailedLink(address string) *url.URL {
+	s.t.Helper()
+	var msg mailer.Message
+	select {
+	case msg = <-s.mail.sent:
+	case <-time.After(5 * time.Second):
+		s.t.Fatalf("no email sent to %q", address)
+	}
+	if msg.To != address {
+		s.t.Fatalf("email sent to %q, want %q", msg.To, address)
+	}
+	link, err := url.Parse(regexp.MustCompile(`https?://\S+`).FindString(msg.Body))
+	if err != nil || link.Host == "" {
+		s.t.Fatalf("no link in the email:\n%s", msg.Body)
+	}
+	return link
+}
+
+func (s *testServer) userID(email string) int {
+	s.t.Helper()
+	user, err := s.repos.Users.GetByEmail(context.Background(), email)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	return user.ID
+}
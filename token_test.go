@@ -0,0 +1,101 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	m "final-project/model"
+)
+
+func TestRefreshTokenReuse(t *testing.T) {
+	s := newTestServer(t, nil)
+	s.register("user@example.com")
+	first := s.login("user@example.com", testPassword)
+
+	response := s.expect(http.StatusOK, "POST", "/user/token/refresh", nil, m.RefreshRequest{RefreshToken: first.refresh})
+	second := tokens{access: response["access_token"].(string), refresh: response["refresh_token"].(string)}
+
+	steps := []struct {
+		name   string
+		method string
+		path   string
+		header http.Header
+		body   interface{}
+		want   int
+	}{
+		{"rotated token works", "GET", "/user", bearer(second.access), nil, http.StatusOK},
+		{"used token is refused", "POST", "/user/token/refresh", nil, m.RefreshRequest{RefreshToken: first.refresh}, http.StatusUnauthorized},
+		{"reuse ends the session", "POST", "/user/token/refresh", nil, m.RefreshRequest{RefreshToken: second.refresh}, http.StatusUnauthorized},
+		{"reuse revokes its access tokens", "GET", "/user", bearer(second.access), nil, http.StatusUnauthorized},
+	}
+	for _, step := range steps {
+		if w := s.do(step.method, step.path, step.header, step.body); w.Code != step.want {
+			t.Errorf("%s: %s %s = %d, want %d", step.name, step.method, step.path, w.Code, step.want)
+		}
+	}
+}
+
+func TestTokenRevocation(t *testing.T) {
+	tests := []struct {
+		name string
+		// revoke ends the victim session, acting from victim or other.
+		revoke func(s *testServer, victim, other tokens)
+		// otherWorks is whether the tokens of the other session survive.
+		otherWorks bool
+	}{
+		{
+			name: "logout",
+			revoke: func(s *testServer, victim, _ tokens) {
+				s.expect(http.StatusOK, "POST", "/user/logout", bearer(victim.access), nil)
+			},
+			otherWorks: true,
+		},
+		{
+			name: "revoke session",
+			revoke: func(s *testServer, victim, other tokens) {
+				s.expect(http.StatusOK, "DELETE", "/session/"+s.currentSession(victim), bearer(other.access), nil)
+			},
+			otherWorks: true,
+		},
+		{
+			name: "revoke other sessions",
+			revoke: func(s *testServer, _, other tokens) {
+				s.expect(http.StatusOK, "DELETE", "/sessions", bearer(other.access), nil)
+			},
+			otherWorks: true,
+		},
+		{
+			name: "change password",
+			revoke: func(s *testServer, _, other tokens) {
+				s.expect(http.StatusOK, "POST", "/user/password", bearer(other.access),
+					m.ChangePasswordRequest{CurrentPassword: testPassword, NewPassword: otherPassword})
+			},
+			// The token version bump ends every token, the caller's too.
+			otherWorks: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, nil)
+			s.register("user@example.com")
+			victim := s.login("user@example.com", testPassword)
+			other := s.login("user@example.com", testPassword)
+
+			tt.revoke(s, victim, other)
+
+			if w := s.do("GET", "/user", bearer(victim.access), nil); w.Code != http.StatusUnauthorized {
+				t.Errorf("revoked access token: GET /user = %d, want 401", w.Code)
+			}
+			if w := s.do("POST", "/user/token/refresh", nil, m.RefreshRequest{RefreshToken: victim.refresh}); w.Code != http.StatusUnauthorized {
+				t.Errorf("revoked refresh token: POST /user/token/refresh = %d, want 401", w.Code)
+			}
+			want := http.StatusUnauthorized
+			if tt.otherWorks {
+				want = http.StatusOK
+			}
+			if w := s.do("GET", "/user", bearer(other.access), nil); w.Code != want {
+				t.Errorf("other access token: GET /user = %d, want %d", w.Code, want)
+			}
+		})
+	}
+}
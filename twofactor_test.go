@@ -0,0 +1,97 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	m "final-project/model"
+)
+
+// totpCode is the code of an authenticator app for secret at step.
+func totpCode(t *testing.T, secret string, step int64) string {
+	t.Helper()
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(step))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%06d", value%1000000)
+}
+
+// enableTwoFactor turns on 2FA for the user of session and returns the
+// TOTP secret and the step of the code used to enable it.
+func (s *testServer) enableTwoFactor(session tokens) (string, int64) {
+	s.t.Helper()
+	response := s.expect(http.StatusOK, "POST", "/user/2fa/setup", bearer(session.access), nil)
+	secret := response["secret"].(string)
+	step := time.Now().Unix() / 30
+	s.expect(http.StatusOK, "POST", "/user/2fa/enable", bearer(session.access), m.TwoFactorCodeRequest{Code: totpCode(s.t, secret, step)})
+	return secret, step
+}
+
+// challenge logs in with a password and returns the second factor challenge.
+func (s *testServer) challenge(email string) string {
+	s.t.Helper()
+	response := s.expect(http.StatusOK, "POST", "/user/login", nil, credentials(email, testPassword))
+	challenge, _ := response["challenge_token"].(string)
+	if challenge == "" {
+		s.t.Fatalf("login did not ask for a second factor: %v", response)
+	}
+	return challenge
+}
+
+func TestTwoFactorStepReplay(t *testing.T) {
+	s := newTestServer(t, nil)
+	s.register("user@example.com")
+	// Both steps stay within the accepted skew even if the clock moves on
+	// to the next step during the test.
+	secret, step := s.enableTwoFactor(s.login("user@example.com", testPassword))
+
+	attempts := []struct {
+		name string
+		code string
+		want int
+	}{
+		{"code used to enable", totpCode(t, secret, step), http.StatusUnauthorized},
+		{"next code", totpCode(t, secret, step+1), http.StatusOK},
+		{"next code again", totpCode(t, secret, step+1), http.StatusUnauthorized},
+	}
+	for _, attempt := range attempts {
+		request := m.TwoFactorLoginRequest{ChallengeToken: s.challenge("user@example.com"), Code: attempt.code}
+		w := s.do("POST", "/user/login/2fa", nil, request)
+		if w.Code != attempt.want {
+			t.Errorf("%s: POST /user/login/2fa = %d %q, want %d", attempt.name, w.Code, strings.TrimSpace(w.Body.String()), attempt.want)
+		}
+	}
+}
+
+func TestTwoFactorAttemptLimit(t *testing.T) {
+	s := newTestServer(t, nil)
+	s.register("user@example.com")
+	secret, step := s.enableTwoFactor(s.login("user@example.com", testPassword))
+
+	// Ten wrong codes per user, spread over challenges that each stay under
+	// their own limit of five.
+	var challenge string
+	for i := 0; i < 10; i++ {
+		if i%3 == 0 {
+			challenge = s.challenge("user@example.com")
+		}
+		s.expect(http.StatusUnauthorized, "POST", "/user/login/2fa", nil, m.TwoFactorLoginRequest{ChallengeToken: challenge, Code: "wrong"})
+	}
+	request := m.TwoFactorLoginRequest{ChallengeToken: s.challenge("user@example.com"), Code: totpCode(t, secret, step+1)}
+	s.expect(http.StatusTooManyRequests, "POST", "/user/login/2fa", nil, request)
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	m "final-project/model"
+)
+
+func TestEmailVerification(t *testing.T) {
+	s := newTestServer(t, map[string]string{"EMAIL_VERIFICATION": "true"})
+	s.register("user@example.com")
+	link := s.mailedLink("user@example.com").RequestURI()
+
+	steps := []struct {
+		name   string
+		method string
+		path   string
+		body   interface{}
+		want   int
+	}{
+		{"unverified login is refused", "POST", "/user/login", credentials("user@example.com", testPassword), http.StatusForbidden},
+		{"bad token", "GET", "/user/verify?token=bad", nil, http.StatusBadRequest},
+		{"mailed link verifies", "GET", link, nil, http.StatusOK},
+		{"verified login", "POST", "/user/login", credentials("user@example.com", testPassword), http.StatusOK},
+		{"resend for a verified address", "POST", "/user/verify/resend", m.ResendVerificationRequest{Email: "user@example.com"}, http.StatusAccepted},
+		{"resend for an unknown address", "POST", "/user/verify/resend", m.ResendVerificationRequest{Email: "nobody@example.com"}, http.StatusAccepted},
+	}
+	for _, step := range steps {
+		if w := s.do(step.method, step.path, nil, step.body); w.Code != step.want {
+			t.Errorf("%s: %s %s = %d, want %d", step.name, step.method, step.path, w.Code, step.want)
+		}
+	}
+	if len(s.mail.sent) != 0 {
+		t.Errorf("sent %d emails to verified or unknown addresses, want 0", len(s.mail.sent))
+	}
+}
+
+func TestResendVerification(t *testing.T) {
+	tests := []struct {
+		name         string
+		verification string
+		mailErr      error
+		want         int
+		wantSent     int
+	}{
+		{"verification on", "true", nil, http.StatusAccepted, 1},
+		{"verification off", "false", nil, http.StatusNotFound, 0},
+		{"mailer fails", "true", errors.New("mail server down"), http.StatusAccepted, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, map[string]string{"EMAIL_VERIFICATION": tt.verification})
+			s.register("user@example.com")
+			// Drop the email sent on registration.
+			for len(s.mail.sent) > 0 {
+				<-s.mail.sent
+			}
+			s.mail.err = tt.mailErr
+
+			s.expect(tt.want, "POST", "/user/verify/resend", nil, m.ResendVerificationRequest{Email: "user@example.com"})
+			if len(s.mail.sent) != tt.wantSent {
+				t.Errorf("sent %d emails, want %d", len(s.mail.sent), tt.wantSent)
+			}
+		})
+	}
+}